@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/base/op-enclave/op-enclave/enclave"
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+)
+
+// replays a capture written by the proposer (see --capture-dir) outside of the enclave,
+// reporting which validation step failed
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s <capture.json>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	oplog.SetupDefaults()
+
+	capture, err := enclave.ReadCapture(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading capture: %v\n", err)
+		os.Exit(2)
+	}
+	if len(capture.Blocks) == 0 || capture.Config == nil {
+		fmt.Fprintf(os.Stderr, "Capture has no config or blocks\n")
+		os.Exit(2)
+	}
+	first := capture.Blocks[0].BlockHeader.Number
+	last := capture.Blocks[len(capture.Blocks)-1].BlockHeader.Number
+	fmt.Printf("Replaying blocks %s-%s (config %s)\n", first, last, capture.Config.Hash())
+
+	outputRoot, err := capture.Replay(context.Background())
+	if err == nil {
+		fmt.Printf("OK: output root %s\n", outputRoot)
+		return
+	}
+
+	var replayErr *enclave.ReplayError
+	if errors.As(err, &replayErr) {
+		fmt.Printf("FAILED: block %s\n", replayErr.Block)
+	} else {
+		fmt.Printf("FAILED\n")
+	}
+	if enclaveErr := enclave.ParseError(err); enclaveErr != nil {
+		fmt.Printf("  check:    %s\n", enclaveErr.Check)
+		fmt.Printf("  code:     %d\n", enclaveErr.Code)
+		if enclaveErr.Expected != nil && enclaveErr.Actual != nil {
+			fmt.Printf("  expected: %s\n", enclaveErr.Expected)
+			fmt.Printf("  computed: %s\n", enclaveErr.Actual)
+		}
+	}
+	fmt.Printf("  error:    %v\n", err)
+	os.Exit(1)
+}
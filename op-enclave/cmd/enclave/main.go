@@ -1,20 +1,41 @@
 package main
 
 import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"os"
 
 	enclave2 "github.com/base/op-enclave/op-enclave/enclave"
 	oplog "github.com/ethereum-optimism/optimism/op-service/log"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/mdlayher/vsock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 func main() {
-	oplog.SetupDefaults()
+	// logs are written to stdout, and streamed to the parent instance over telemetry
+	logs := enclave2.NewLogStream()
+	oplog.SetGlobalLogHandler(log.JSONHandlerWithLevel(io.MultiWriter(os.Stdout, logs), log.LevelInfo))
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	go serveTelemetry(logs, registry)
 
 	s := rpc.NewServer()
-	serv, err := enclave2.NewServer()
+	cfg, err := enclave2.ServerConfigFromEnv()
+	if err != nil {
+		log.Crit("Error loading server config", "error", err)
+	}
+	cfg.Metrics = registry
+	serv, err := enclave2.NewServer(cfg)
 	if err != nil {
 		log.Crit("Error creating API server", "error", err)
 	}
@@ -23,14 +44,70 @@ func main() {
 		log.Crit("Error registering API", "error", err)
 	}
 
+	tlsConfig, err := enclave2.NewRATLSConfig(cfg.Attestor)
+	if err != nil {
+		log.Crit("Error creating RA-TLS config", "error", err)
+	}
+	s.SetHTTPBodyLimit(cfg.Limits.MaxRequestSize)
+	go serveRATLS(s, tlsConfig)
+
+	// the plaintext endpoint serves the full API, unless limited to the read-only API
+	plaintext := s
+	readOnly, err := enclave2.PlaintextReadOnlyFromEnv()
+	if err != nil {
+		log.Crit("Error loading plaintext API config", "error", err)
+	}
+	if readOnly {
+		plaintext = rpc.NewServer()
+		if err = plaintext.RegisterName(enclave2.Namespace, enclave2.NewReadOnlyAPI(serv)); err != nil {
+			log.Crit("Error registering read-only API", "error", err)
+		}
+		plaintext.SetHTTPBodyLimit(cfg.Limits.MaxRequestSize)
+	}
+
 	listener, err := vsock.Listen(1234, &vsock.Config{})
 	if err != nil {
 		log.Warn("Error opening vsock listener, running in HTTP mode", "error", err)
-		err = http.ListenAndServe(":1234", s)
+		err = http.ListenAndServe(":1234", plaintext)
 	} else {
-		err = s.ServeListener(listener)
+		err = enclave2.ServeListener(plaintext, listener, cfg.Limits.MaxRequestSize)
 	}
 	if err != nil {
 		log.Crit("Error starting server", "error", err)
 	}
 }
+
+// serveRATLS serves the JSON-RPC API over HTTPS on port 1235, terminating TLS inside
+// the enclave with an attested certificate (see enclave.NewRATLSConfig).
+func serveRATLS(s *rpc.Server, tlsConfig *tls.Config) {
+	listener, err := listen(1235)
+	if err != nil {
+		log.Crit("Error opening RA-TLS listener", "error", err)
+	}
+	err = http.Serve(tls.NewListener(listener, tlsConfig), s)
+	if err != nil {
+		log.Crit("Error starting RA-TLS server", "error", err)
+	}
+}
+
+// serveTelemetry serves logs and metrics on port 1236 (see enclave.ServeTelemetry).
+func serveTelemetry(logs *enclave2.LogStream, registry *prometheus.Registry) {
+	listener, err := listen(1236)
+	if err != nil {
+		log.Crit("Error opening telemetry listener", "error", err)
+	}
+	err = enclave2.ServeTelemetry(listener, logs, registry)
+	if err != nil {
+		log.Crit("Error starting telemetry server", "error", err)
+	}
+}
+
+// listen opens a vsock listener on the port, falling back to TCP outside an enclave.
+func listen(port uint32) (net.Listener, error) {
+	listener, err := vsock.Listen(port, &vsock.Config{})
+	if err != nil {
+		log.Warn("Error opening vsock listener, running in TCP mode", "port", port, "error", err)
+		return net.Listen("tcp", fmt.Sprintf(":%d", port))
+	}
+	return listener, nil
+}
@@ -1,70 +1,72 @@
 package main
 
 import (
-	"encoding/json"
-	"io"
-	"log"
+	"context"
+	"errors"
+	"net"
 	"net/http"
-	"sync"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/mdlayher/vsock"
+	"github.com/base/op-enclave/op-enclave/proxy"
+	oplog "github.com/ethereum-optimism/optimism/op-service/log"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
-// small HTTP proxy that forwards requests to a vsock service
+// HTTP proxy that forwards requests to the enclave over vsock (see package proxy)
 func main() {
-	pool := sync.Pool{
-		New: func() any {
-			conn, err := vsock.Dial(16, 1234, &vsock.Config{})
-			if err != nil {
-				log.Printf("Error dialing vsock: %v", err)
-				return nil
-			}
-			return conn
-		},
-	}
+	oplog.SetupDefaults()
 
-	handler := func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		req, err := io.ReadAll(r.Body)
-		if err != nil {
-			log.Printf("Error reading request body: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		_ = r.Body.Close()
+	cfg, err := proxy.ConfigFromEnv()
+	if err != nil {
+		log.Crit("Error loading proxy config", "error", err)
+	}
 
-		conn := pool.Get().(*vsock.Conn)
-		if conn == nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		defer pool.Put(conn)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	p := proxy.New(cfg, proxy.VsockDialer(cfg.CID), registry)
+	defer p.Close()
 
-		_, err = conn.Write(req)
-		if err != nil {
-			log.Printf("Error writing to vsock: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		dec := json.NewDecoder(conn)
-		dec.UseNumber()
+	rpcServer := &http.Server{Addr: cfg.RPCAddr, Handler: p.Handler()}
+	metricsServer := &http.Server{Addr: cfg.MetricsAddr, Handler: p.MetricsHandler()}
+	passthrough, err := net.Listen("tcp", cfg.RATLSAddr)
+	if err != nil {
+		log.Crit("Error starting passthrough listener", "error", err)
+	}
 
-		var raw json.RawMessage
-		if err := dec.Decode(&raw); err != nil {
-			log.Printf("Error decoding response: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+	go p.RelayLogs(ctx, os.Stdout)
+	go func() {
+		if err := p.Passthrough(passthrough); err != nil {
+			log.Crit("Error serving passthrough", "error", err)
 		}
-
-		_, _ = w.Write(raw)
+	}()
+	for _, server := range []*http.Server{rpcServer, metricsServer} {
+		go func(server *http.Server) {
+			if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Crit("Error starting server", "addr", server.Addr, "error", err)
+			}
+		}(server)
 	}
+	log.Info("Proxy started", "cid", cfg.CID, "rpc", cfg.RPCAddr, "ratls", cfg.RATLSAddr, "metrics", cfg.MetricsAddr)
 
-	err := http.ListenAndServe(":7333", http.HandlerFunc(handler))
-	if err != nil {
-		log.Fatalf("Error starting server: %v", err)
+	<-ctx.Done()
+	log.Info("Shutting down, waiting for in-flight requests", "timeout", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	_ = passthrough.Close()
+	if err := rpcServer.Shutdown(shutdownCtx); err != nil {
+		log.Warn("Error shutting down RPC server", "error", err)
+	}
+	if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+		log.Warn("Error shutting down metrics server", "error", err)
 	}
 }
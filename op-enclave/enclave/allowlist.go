@@ -0,0 +1,228 @@
+package enclave
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const configAllowlistTag = "op-enclave/config-allowlist"
+
+// ConfigAllowlistConfig configures the optional allowlist of PerChainConfig hashes
+// that the enclave will execute and sign proposals for.
+type ConfigAllowlistConfig struct {
+	// Hashes is the allowlist loaded at boot.
+	Hashes []common.Hash
+	// Owner is the address that signs allowlist updates. If zero, the allowlist
+	// cannot be updated.
+	Owner common.Address
+}
+
+// Enabled returns true if configs must be allowlisted.
+func (c ConfigAllowlistConfig) Enabled() bool {
+	return len(c.Hashes) > 0 || c.Owner != (common.Address{})
+}
+
+// ConfigAllowlistConfigFromEnv reads the allowlist from the OP_ENCLAVE_CONFIG_ALLOWLIST
+// (comma separated config hashes) and OP_ENCLAVE_CONFIG_ALLOWLIST_OWNER env vars.
+func ConfigAllowlistConfigFromEnv() (ConfigAllowlistConfig, error) {
+	var cfg ConfigAllowlistConfig
+	if hashes := os.Getenv("OP_ENCLAVE_CONFIG_ALLOWLIST"); hashes != "" {
+		for _, item := range strings.Split(hashes, ",") {
+			hash, err := hexutil.Decode(strings.TrimSpace(item))
+			if err != nil || len(hash) != common.HashLength {
+				return cfg, fmt.Errorf("invalid OP_ENCLAVE_CONFIG_ALLOWLIST hash: %s", item)
+			}
+			cfg.Hashes = append(cfg.Hashes, common.BytesToHash(hash))
+		}
+	}
+	if owner := os.Getenv("OP_ENCLAVE_CONFIG_ALLOWLIST_OWNER"); owner != "" {
+		if !common.IsHexAddress(owner) {
+			return cfg, fmt.Errorf("invalid OP_ENCLAVE_CONFIG_ALLOWLIST_OWNER: %s", owner)
+		}
+		cfg.Owner = common.HexToAddress(owner)
+	}
+	return cfg, nil
+}
+
+// ConfigAllowlistUpdate replaces the config allowlist. It must be signed by the
+// allowlist owner, and is bound to the PCR0 of the enclave image it is intended for.
+// Updates must have increasing sequence numbers, and cannot be applied after expiry.
+// As updates are not persisted, an enclave reverts to its boot allowlist on restart.
+//
+// The sequence number is also reset on restart, so updates are bound to the nonce
+// the enclave generates at boot (see ConfigAllowlist.Nonce): the host cannot restart
+// the enclave to replay an update signed for an earlier boot. Expiry is checked
+// against the trusted clock, so the host cannot set the clock back to apply an update
+// after it expired on L1.
+type ConfigAllowlistUpdate struct {
+	Nonce     common.Hash
+	Sequence  uint64
+	Expiry    uint64
+	Hashes    []common.Hash
+	Signature []byte
+}
+
+// Digest returns the hash signed by the allowlist owner.
+func (u *ConfigAllowlistUpdate) Digest(pcr0 []byte) common.Hash {
+	data := append([]byte(configAllowlistTag), crypto.Keccak256(pcr0)...)
+	data = append(data, u.Nonce[:]...)
+	data = binary.BigEndian.AppendUint64(data, u.Sequence)
+	data = binary.BigEndian.AppendUint64(data, u.Expiry)
+	for _, hash := range u.Hashes {
+		data = append(data, hash[:]...)
+	}
+	return crypto.Keccak256Hash(data)
+}
+
+// Sign signs the update for the enclave image with the given PCR0.
+func (u *ConfigAllowlistUpdate) Sign(key *ecdsa.PrivateKey, pcr0 []byte) error {
+	digest := u.Digest(pcr0)
+	sig, err := crypto.Sign(digest[:], key)
+	if err != nil {
+		return fmt.Errorf("failed to sign: %w", err)
+	}
+	u.Signature = sig
+	return nil
+}
+
+// ConfigAllowlist lists the active config allowlist entries.
+type ConfigAllowlist struct {
+	Enabled  bool           `json:"enabled"`
+	Owner    common.Address `json:"owner"`
+	Nonce    common.Hash    `json:"nonce"`
+	Sequence hexutil.Uint64 `json:"sequence"`
+	Hashes   []common.Hash  `json:"hashes"`
+}
+
+type configAllowlist struct {
+	enabled  bool
+	owner    common.Address
+	nonce    common.Hash
+	mutex    sync.RWMutex
+	sequence uint64
+	hashes   map[common.Hash]struct{}
+}
+
+func newConfigAllowlist(cfg ConfigAllowlistConfig, random io.Reader) (*configAllowlist, error) {
+	a := &configAllowlist{
+		enabled: cfg.Enabled(),
+		owner:   cfg.Owner,
+	}
+	if _, err := io.ReadFull(random, a.nonce[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate config allowlist nonce: %w", err)
+	}
+	a.set(cfg.Hashes)
+	return a, nil
+}
+
+func (a *configAllowlist) set(hashes []common.Hash) {
+	a.hashes = make(map[common.Hash]struct{}, len(hashes))
+	for _, hash := range hashes {
+		a.hashes[hash] = struct{}{}
+	}
+}
+
+func (a *configAllowlist) check(configHash common.Hash) error {
+	if !a.enabled {
+		return nil
+	}
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if _, ok := a.hashes[configHash]; !ok {
+		return newError(ErrorCodeUnauthorized, "config_allowlist", fmt.Sprintf("config %s is not allowlisted", configHash))
+	}
+	return nil
+}
+
+func (a *configAllowlist) list() *ConfigAllowlist {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	hashes := make([]common.Hash, 0, len(a.hashes))
+	for hash := range a.hashes {
+		hashes = append(hashes, hash)
+	}
+	slices.SortFunc(hashes, func(x, y common.Hash) int {
+		return x.Cmp(y)
+	})
+	return &ConfigAllowlist{
+		Enabled:  a.enabled,
+		Owner:    a.owner,
+		Nonce:    a.nonce,
+		Sequence: hexutil.Uint64(a.sequence),
+		Hashes:   hashes,
+	}
+}
+
+// update applies the update if it is signed by the owner for this boot, and has not
+// expired at now, which should be the trusted clock's time.
+func (a *configAllowlist) update(u *ConfigAllowlistUpdate, pcr0 []byte, now time.Time) error {
+	if a.owner == (common.Address{}) {
+		return errors.New("config allowlist has no owner")
+	}
+	if u.Nonce != a.nonce {
+		return errors.New("config allowlist update was not signed for this enclave boot")
+	}
+	if now.Unix() > int64(u.Expiry) {
+		return errors.New("config allowlist update has expired")
+	}
+	if len(u.Signature) != crypto.SignatureLength {
+		return errors.New("invalid config allowlist update signature")
+	}
+	digest := u.Digest(pcr0)
+	sig := make([]byte, crypto.SignatureLength)
+	copy(sig, u.Signature)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	public, err := crypto.SigToPub(digest[:], sig)
+	if err != nil {
+		return fmt.Errorf("failed to recover signer: %w", err)
+	}
+	if crypto.PubkeyToAddress(*public) != a.owner {
+		return errors.New("config allowlist update is not signed by the owner")
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if u.Sequence <= a.sequence {
+		return fmt.Errorf("config allowlist update sequence %d is not greater than %d", u.Sequence, a.sequence)
+	}
+	a.sequence = u.Sequence
+	a.set(u.Hashes)
+	return nil
+}
+
+// ConfigAllowlist returns the active config allowlist.
+func (s *Server) ConfigAllowlist(ctx context.Context) (*ConfigAllowlist, error) {
+	return s.allowlist.list(), nil
+}
+
+// UpdateConfigAllowlist applies an RLP encoded ConfigAllowlistUpdate. It returns an
+// attestation with the update's digest as user data, confirming the update was applied.
+func (s *Server) UpdateConfigAllowlist(ctx context.Context, update hexutil.Bytes) (hexutil.Bytes, error) {
+	var u ConfigAllowlistUpdate
+	if err := rlp.DecodeBytes(update, &u); err != nil {
+		return nil, fmt.Errorf("failed to decode config allowlist update: %w", err)
+	}
+	if err := s.allowlist.update(&u, s.pcr0, s.clock.now()); err != nil {
+		return nil, err
+	}
+	log.Info("Updated config allowlist", "sequence", u.Sequence, "entries", len(u.Hashes))
+	digest := u.Digest(s.pcr0)
+	return s.attestor.Attest(nil, digest[:], nil)
+}
@@ -0,0 +1,57 @@
+package enclave
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestConfigAllowlistUpdate(t *testing.T) {
+	owner, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcr0 := bytes.Repeat([]byte{1}, emulatorPCRLength)
+	cfg := ConfigAllowlistConfig{Owner: crypto.PubkeyToAddress(owner.PublicKey)}
+	newAllowlist := func() *configAllowlist {
+		a, err := newConfigAllowlist(cfg, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	allowlist := newAllowlist()
+	now := time.Unix(1_000_000, 0)
+	sign := func(nonce common.Hash, sequence uint64, expiry uint64) *ConfigAllowlistUpdate {
+		u := &ConfigAllowlistUpdate{Nonce: nonce, Sequence: sequence, Expiry: expiry, Hashes: []common.Hash{{1}}}
+		if err := u.Sign(owner, pcr0); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	update := sign(allowlist.nonce, 1, uint64(now.Unix()))
+	if err = allowlist.update(update, pcr0, now); err != nil {
+		t.Fatalf("valid update was rejected: %v", err)
+	}
+	if err = allowlist.update(update, pcr0, now); err == nil {
+		t.Fatal("replayed update was accepted")
+	}
+	if err = newAllowlist().update(update, pcr0, now); err == nil {
+		t.Fatal("update signed for another boot was accepted")
+	}
+
+	update = sign(allowlist.nonce, 2, uint64(now.Unix()))
+	if err = allowlist.update(update, pcr0, now.Add(time.Second)); err == nil {
+		t.Fatal("expired update was accepted")
+	}
+
+	update.Signature[crypto.RecoveryIDOffset] += 27
+	if err = allowlist.update(update, pcr0, now); err != nil {
+		t.Fatalf("update with a recovery id of 27 or 28 was rejected: %v", err)
+	}
+}
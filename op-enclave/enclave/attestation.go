@@ -0,0 +1,159 @@
+package enclave
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/hf/nsm"
+	"github.com/hf/nsm/request"
+)
+
+// Attestor abstracts the Nitro Secure Module functionality used by the Server:
+// a source of entropy, PCR measurements, and signed attestation documents.
+type Attestor interface {
+	io.Reader
+
+	// PCR returns the value of the platform configuration register at the given index.
+	PCR(index uint) ([]byte, error)
+	// Attest returns a COSE_Sign1 encoded attestation document containing the given fields.
+	Attest(publicKey, userData, nonce []byte) ([]byte, error)
+	// Roots returns the CA roots that attestation documents produced by this Attestor chain to.
+	Roots() *x509.CertPool
+	// Local returns true if the Attestor is not backed by Nitro Secure Module hardware.
+	Local() bool
+}
+
+// NewDefaultAttestor opens a Nitro Secure Module session. If none is available, it only
+// falls back to a software emulator (configured using the OP_ENCLAVE_EMULATOR_PCRS env
+// var) when local mode is explicitly enabled with OP_ENCLAVE_LOCAL=true, as emulated
+// attestations are signed by a CA that anyone can derive.
+func NewDefaultAttestor() (Attestor, error) {
+	attestor, err := NewNSMAttestor()
+	if err == nil {
+		return attestor, nil
+	}
+	local, localErr := envBool("OP_ENCLAVE_LOCAL")
+	if localErr != nil {
+		return nil, localErr
+	}
+	if !local {
+		return nil, fmt.Errorf("failed to open Nitro Secure Module session (set OP_ENCLAVE_LOCAL=true to run in local mode): %w", err)
+	}
+	log.Warn("failed to open Nitro Secure Module session, running in local mode", "error", err)
+	pcrs, err := ParsePCRs(os.Getenv("OP_ENCLAVE_EMULATOR_PCRS"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse emulator PCRs: %w", err)
+	}
+	return NewEmulatedAttestor(pcrs)
+}
+
+// ParsePCRs parses a comma separated list of index=hex PCR values, e.g. "0=0x00..,8=0x00..".
+func ParsePCRs(s string) (map[uint][]byte, error) {
+	values, err := parsePCRValues(s)
+	if err != nil {
+		return nil, err
+	}
+	pcrs := make(map[uint][]byte, len(values))
+	for _, v := range values {
+		pcrs[v.index] = v.value
+	}
+	return pcrs, nil
+}
+
+type pcrValue struct {
+	index uint
+	value []byte
+}
+
+func parsePCRValues(s string) ([]pcrValue, error) {
+	var values []pcrValue
+	if s == "" {
+		return values, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		index, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid PCR entry: %s", item)
+		}
+		i, err := strconv.ParseUint(index, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PCR index %s: %w", index, err)
+		}
+		pcr, err := hexutil.Decode(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PCR value for index %d: %w", i, err)
+		}
+		values = append(values, pcrValue{index: uint(i), value: pcr})
+	}
+	return values, nil
+}
+
+type nsmAttestor struct {
+	session *nsm.Session
+}
+
+var _ Attestor = (*nsmAttestor)(nil)
+
+// NewNSMAttestor returns an Attestor backed by the Nitro Secure Module device.
+func NewNSMAttestor() (Attestor, error) {
+	session, err := nsm.OpenDefaultSession()
+	if err != nil {
+		return nil, err
+	}
+	return &nsmAttestor{
+		session: session,
+	}, nil
+}
+
+func (a *nsmAttestor) Read(p []byte) (int, error) {
+	return a.session.Read(p)
+}
+
+func (a *nsmAttestor) PCR(index uint) ([]byte, error) {
+	res, err := a.session.Send(&request.DescribePCR{
+		Index: uint16(index),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe PCR: %w", err)
+	}
+	if res.Error != "" {
+		return nil, fmt.Errorf("NSM device returned an error: %s", res.Error)
+	}
+	if res.DescribePCR == nil || res.DescribePCR.Data == nil || len(res.DescribePCR.Data) == 0 {
+		return nil, errors.New("NSM device did not return PCR data")
+	}
+	return res.DescribePCR.Data, nil
+}
+
+func (a *nsmAttestor) Attest(publicKey, userData, nonce []byte) ([]byte, error) {
+	res, err := a.session.Send(&request.Attestation{
+		PublicKey: publicKey,
+		UserData:  userData,
+		Nonce:     nonce,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attestation: %w", err)
+	}
+	if res.Error != "" {
+		return nil, fmt.Errorf("NSM device returned an error: %s", res.Error)
+	}
+	if res.Attestation == nil || res.Attestation.Document == nil {
+		return nil, errors.New("NSM device did not return an attestation")
+	}
+	return res.Attestation.Document, nil
+}
+
+func (a *nsmAttestor) Roots() *x509.CertPool {
+	return defaultRoot
+}
+
+func (a *nsmAttestor) Local() bool {
+	return false
+}
@@ -0,0 +1,254 @@
+package enclave
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/hf/nitrite"
+)
+
+const (
+	defaultAttestationMaxAge = 5 * time.Minute
+	maxAttestationClockSkew  = time.Minute
+)
+
+// AttestationPolicy configures how attestation documents from other enclaves are verified.
+type AttestationPolicy struct {
+	// Roots is the CA root bundle that attestations must chain to. If nil, the roots of
+	// the Server's Attestor are used.
+	Roots *x509.CertPool
+	// PCRs lists the PCR indexes that must match. Each PCR must either equal this
+	// enclave's own value, or one of the values in Allowlist for that index.
+	PCRs []uint
+	// Allowlist contains additional accepted values per PCR index, e.g. the PCR0 of a
+	// successor enclave image that keys can be migrated to.
+	Allowlist map[uint][][]byte
+	// MaxAge is the maximum age of an attestation document. Zero disables the check.
+	MaxAge time.Duration
+	// RequireUserData rejects attestations without user_data.
+	RequireUserData bool
+	// RequireNonce rejects attestations without a nonce.
+	RequireNonce bool
+	// RequireTrustedTime rejects all attestations until the enclave has processed an L1
+	// header, instead of relying on its clock alone (see trustedClock).
+	RequireTrustedTime bool
+}
+
+// DefaultAttestationPolicy requires PCR0 to match this enclave's own PCR0.
+func DefaultAttestationPolicy() AttestationPolicy {
+	return AttestationPolicy{
+		PCRs:   []uint{0},
+		MaxAge: defaultAttestationMaxAge,
+	}
+}
+
+// AttestationPolicyFromEnv returns the DefaultAttestationPolicy, overridden by the
+// OP_ENCLAVE_ATTESTATION_* env vars.
+func AttestationPolicyFromEnv() (AttestationPolicy, error) {
+	policy := DefaultAttestationPolicy()
+	if roots := os.Getenv("OP_ENCLAVE_ATTESTATION_CA_ROOTS"); roots != "" {
+		policy.Roots = x509.NewCertPool()
+		if !policy.Roots.AppendCertsFromPEM([]byte(roots)) {
+			return policy, errors.New("failed to parse OP_ENCLAVE_ATTESTATION_CA_ROOTS")
+		}
+	}
+	if pcrs := os.Getenv("OP_ENCLAVE_ATTESTATION_PCRS"); pcrs != "" {
+		policy.PCRs = nil
+		for _, item := range strings.Split(pcrs, ",") {
+			index, err := strconv.ParseUint(strings.TrimSpace(item), 10, 8)
+			if err != nil {
+				return policy, fmt.Errorf("invalid OP_ENCLAVE_ATTESTATION_PCRS index %s: %w", item, err)
+			}
+			policy.PCRs = append(policy.PCRs, uint(index))
+		}
+	}
+	if allowlist := os.Getenv("OP_ENCLAVE_ATTESTATION_ALLOWLIST"); allowlist != "" {
+		values, err := parsePCRValues(allowlist)
+		if err != nil {
+			return policy, fmt.Errorf("invalid OP_ENCLAVE_ATTESTATION_ALLOWLIST: %w", err)
+		}
+		policy.Allowlist = make(map[uint][][]byte)
+		for _, v := range values {
+			policy.Allowlist[v.index] = append(policy.Allowlist[v.index], v.value)
+		}
+	}
+	if maxAge := os.Getenv("OP_ENCLAVE_ATTESTATION_MAX_AGE"); maxAge != "" {
+		d, err := time.ParseDuration(maxAge)
+		if err != nil {
+			return policy, fmt.Errorf("invalid OP_ENCLAVE_ATTESTATION_MAX_AGE: %w", err)
+		}
+		policy.MaxAge = d
+	}
+	var err error
+	if policy.RequireUserData, err = envBool("OP_ENCLAVE_ATTESTATION_REQUIRE_USER_DATA"); err != nil {
+		return policy, err
+	}
+	if policy.RequireNonce, err = envBool("OP_ENCLAVE_ATTESTATION_REQUIRE_NONCE"); err != nil {
+		return policy, err
+	}
+	if policy.RequireTrustedTime, err = envBool("OP_ENCLAVE_ATTESTATION_REQUIRE_TRUSTED_TIME"); err != nil {
+		return policy, err
+	}
+	return policy, nil
+}
+
+func envBool(name string) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return b, nil
+}
+
+// attestationVerifier applies an AttestationPolicy, using this enclave's own PCR values.
+// If clock is nil, the local clock is used.
+type attestationVerifier struct {
+	policy AttestationPolicy
+	roots  *x509.CertPool
+	own    map[uint][]byte
+	clock  *trustedClock
+}
+
+func newAttestationVerifier(policy AttestationPolicy, attestor Attestor, clock *trustedClock) (*attestationVerifier, error) {
+	roots := policy.Roots
+	if roots == nil {
+		roots = attestor.Roots()
+	}
+	own := make(map[uint][]byte, len(policy.PCRs))
+	for _, index := range policy.PCRs {
+		pcr, err := attestor.PCR(index)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PCR%d: %w", index, err)
+		}
+		own[index] = pcr
+	}
+	return &attestationVerifier{
+		policy: policy,
+		roots:  roots,
+		own:    own,
+		clock:  clock,
+	}, nil
+}
+
+// now returns the time attestations are verified at.
+func (v *attestationVerifier) now() (time.Time, error) {
+	if v.clock == nil {
+		return time.Now(), nil
+	}
+	if _, ok := v.clock.lowerBound(); !ok && v.policy.RequireTrustedTime {
+		return time.Time{}, errors.New("no trusted time, an L1 header has not been processed yet")
+	}
+	return v.clock.now(), nil
+}
+
+// verify verifies the attestation against the policy. If userData or nonce are non-nil,
+// the attestation must contain exactly those values.
+func (v *attestationVerifier) verify(attestation []byte, userData, nonce []byte) (*nitrite.Result, error) {
+	now, err := v.now()
+	if err != nil {
+		return nil, err
+	}
+	return v.verifyAt(attestation, userData, nonce, now, v.policy.MaxAge)
+}
+
+// verifyArchived verifies an attestation that was stored to be verified later, at the
+// time it was produced: its certificates must have been valid at its timestamp, and it
+// has no maximum age.
+func (v *attestationVerifier) verifyArchived(attestation []byte, userData, nonce []byte) (*nitrite.Result, error) {
+	now, err := v.now()
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := attestationTimestamp(attestation)
+	if err != nil {
+		return nil, err
+	}
+	if timestamp.After(now.Add(maxAttestationClockSkew)) {
+		return nil, errors.New("attestation timestamp is in the future")
+	}
+	return v.verifyAt(attestation, userData, nonce, timestamp, 0)
+}
+
+func (v *attestationVerifier) verifyAt(attestation []byte, userData, nonce []byte, now time.Time, maxAge time.Duration) (*nitrite.Result, error) {
+	verification, err := nitrite.Verify(
+		attestation,
+		nitrite.VerifyOptions{
+			Roots:       v.roots,
+			CurrentTime: now,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify attestation: %w", err)
+	}
+	doc := verification.Document
+
+	timestamp := time.UnixMilli(int64(doc.Timestamp))
+	if timestamp.After(now.Add(maxAttestationClockSkew)) {
+		return nil, errors.New("attestation timestamp is in the future")
+	}
+	if maxAge > 0 && now.Sub(timestamp) > maxAge {
+		return nil, fmt.Errorf("attestation is older than %s", maxAge)
+	}
+
+	for _, index := range v.policy.PCRs {
+		if !v.pcrAllowed(index, doc.PCRs[index]) {
+			return nil, fmt.Errorf("attestation does not match PCR%d", index)
+		}
+	}
+
+	if v.policy.RequireUserData && len(doc.UserData) == 0 {
+		return nil, errors.New("attestation is missing user data")
+	}
+	if v.policy.RequireNonce && len(doc.Nonce) == 0 {
+		return nil, errors.New("attestation is missing nonce")
+	}
+	if userData != nil && !bytes.Equal(doc.UserData, userData) {
+		return nil, errors.New("attestation user data mismatch")
+	}
+	if nonce != nil && !bytes.Equal(doc.Nonce, nonce) {
+		return nil, errors.New("attestation nonce mismatch")
+	}
+	return verification, nil
+}
+
+func (v *attestationVerifier) pcrAllowed(index uint, pcr []byte) bool {
+	if len(pcr) == 0 {
+		return false
+	}
+	if bytes.Equal(pcr, v.own[index]) {
+		return true
+	}
+	for _, allowed := range v.policy.Allowlist[index] {
+		if bytes.Equal(pcr, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// attestationTimestamp returns the timestamp of the attestation, without verifying it.
+func attestationTimestamp(attestation []byte) (time.Time, error) {
+	var cose coseSign1
+	if err := cbor.Unmarshal(attestation, &cose); err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode attestation: %w", err)
+	}
+	var doc emulatorDocument
+	if err := cbor.Unmarshal(cose.Payload, &doc); err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode attestation document: %w", err)
+	}
+	if doc.Timestamp == 0 {
+		return time.Time{}, errors.New("attestation has no timestamp")
+	}
+	return time.UnixMilli(int64(doc.Timestamp)), nil
+}
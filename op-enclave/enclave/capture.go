@@ -0,0 +1,82 @@
+package enclave
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Capture is the full set of arguments of an ExecuteStatelessRange call, which can be
+// written to a file and replayed outside of the enclave to debug proof failures.
+type Capture struct {
+	Config             *PerChainConfig    `json:"config"`
+	PrevMessageAccount *eth.AccountResult `json:"prev_message_account"`
+	Blocks             []*BlockInput      `json:"blocks"`
+}
+
+// ReadCapture reads a JSON encoded Capture from path.
+func ReadCapture(path string) (*Capture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Capture
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to decode capture: %w", err)
+	}
+	return &c, nil
+}
+
+// Write writes the Capture to path as JSON.
+func (c *Capture) Write(path string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode capture: %w", err)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// ReplayError is returned by Replay when a captured block fails validation. The
+// underlying error is an *Error for failed checks.
+type ReplayError struct {
+	Block *big.Int
+	Err   error
+}
+
+func (e *ReplayError) Error() string {
+	return fmt.Sprintf("block %s: %s", e.Block, e.Err)
+}
+
+func (e *ReplayError) Unwrap() error {
+	return e.Err
+}
+
+// Replay performs the same validation as ExecuteStatelessRange on the captured
+// arguments, without an enclave or signing. It returns the output root of the
+// last block.
+func (c *Capture) Replay(ctx context.Context) (common.Hash, error) {
+	if len(c.Blocks) == 0 {
+		return common.Hash{}, newError(ErrorCodeInvalidRequest, "blocks", "no blocks")
+	}
+	if err := c.Config.Check(); err != nil {
+		return common.Hash{}, wrapError(ErrorCodeInvalidRequest, "config", "invalid config", err)
+	}
+	inputs, err := newStatelessInputs(c.Blocks)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	config := NewChainConfig(c.Config)
+	if _, failed, err := executeBlocks(ctx, config, c.PrevMessageAccount, inputs); err != nil {
+		return common.Hash{}, &ReplayError{
+			Block: c.Blocks[failed].BlockHeader.Number,
+			Err:   err,
+		}
+	}
+	last := c.Blocks[len(c.Blocks)-1]
+	return OutputRootV0(last.BlockHeader, last.MessageAccount.StorageHash), nil
+}
@@ -2,6 +2,8 @@ package enclave
 
 import (
 	"context"
+	"errors"
+	"sync"
 
 	"github.com/ethereum-optimism/optimism/op-service/eth"
 	"github.com/ethereum/go-ethereum/common"
@@ -13,6 +15,13 @@ import (
 
 type Client struct {
 	*rpc.Client
+
+	// WireFormat forces the format used for execution payloads. If empty, the format
+	// is negotiated with the server on first use, falling back to WireFormatJSON.
+	WireFormat WireFormat
+
+	wireMutex  sync.Mutex
+	negotiated WireFormat
 }
 
 var _ RPC = (*Client)(nil)
@@ -21,6 +30,51 @@ func (c *Client) callContext(ctx context.Context, result interface{}, method str
 	return c.CallContext(ctx, result, Namespace+"_"+method, args...)
 }
 
+// wireFormat returns the format to use for execution payloads.
+func (c *Client) wireFormat(ctx context.Context) (WireFormat, error) {
+	if c.WireFormat != "" {
+		return c.WireFormat, nil
+	}
+	c.wireMutex.Lock()
+	defer c.wireMutex.Unlock()
+	if c.negotiated != "" {
+		return c.negotiated, nil
+	}
+	supported, err := c.WireFormats(ctx)
+	if IsMethodNotFound(err) {
+		supported, err = nil, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	c.negotiated = SelectWireFormat(supported)
+	return c.negotiated, nil
+}
+
+// binaryUnsupported falls back to WireFormatJSON if the server does not support
+// the binary methods, e.g. after being downgraded.
+func (c *Client) binaryUnsupported(err error) bool {
+	if c.WireFormat != "" || !IsMethodNotFound(err) {
+		return false
+	}
+	c.wireMutex.Lock()
+	defer c.wireMutex.Unlock()
+	c.negotiated = WireFormatJSON
+	return true
+}
+
+// IsMethodNotFound returns true if err is the JSON-RPC error for an unknown method,
+// e.g. when calling a method that an older enclave image does not have.
+func IsMethodNotFound(err error) bool {
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32601
+}
+
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var result Status
+	return &result, c.callContext(ctx, &result, "status")
+}
+
 func (c *Client) SignerPublicKey(ctx context.Context) (hexutil.Bytes, error) {
 	var result hexutil.Bytes
 	return result, c.callContext(ctx, &result, "signerPublicKey")
@@ -41,21 +95,167 @@ func (c *Client) DecryptionAttestation(ctx context.Context) (hexutil.Bytes, erro
 	return result, c.callContext(ctx, &result, "decryptionAttestation")
 }
 
-func (c *Client) EncryptedSignerKey(ctx context.Context, attestation hexutil.Bytes) (hexutil.Bytes, error) {
+func (c *Client) KeyTransferRequest(ctx context.Context, version *hexutil.Uint64) (hexutil.Bytes, error) {
+	var result hexutil.Bytes
+	// omit the default version, as images without key transfer version 2 take no arguments
+	if version == nil {
+		return result, c.callContext(ctx, &result, "keyTransferRequest")
+	}
+	return result, c.callContext(ctx, &result, "keyTransferRequest", version)
+}
+
+func (c *Client) EncryptedSignerKey(ctx context.Context, request hexutil.Bytes) (hexutil.Bytes, error) {
+	var result hexutil.Bytes
+	return result, c.callContext(ctx, &result, "encryptedSignerKey", request)
+}
+
+func (c *Client) SetSignerKey(ctx context.Context, response hexutil.Bytes) error {
+	return c.callContext(ctx, nil, "setSignerKey", response)
+}
+
+func (c *Client) RotateSignerKey(ctx context.Context) (hexutil.Bytes, error) {
+	var result hexutil.Bytes
+	return result, c.callContext(ctx, &result, "rotateSignerKey")
+}
+
+func (c *Client) EscrowSignerKey(ctx context.Context, threshold hexutil.Uint64, custodians []hexutil.Bytes) (hexutil.Bytes, error) {
+	var result hexutil.Bytes
+	return result, c.callContext(ctx, &result, "escrowSignerKey", threshold, custodians)
+}
+
+func (c *Client) EscrowShare(ctx context.Context, escrow hexutil.Bytes, request hexutil.Bytes) (hexutil.Bytes, error) {
+	var result hexutil.Bytes
+	return result, c.callContext(ctx, &result, "escrowShare", escrow, request)
+}
+
+func (c *Client) RecoverSignerKey(ctx context.Context, escrow hexutil.Bytes, responses []hexutil.Bytes) (hexutil.Bytes, error) {
+	var result hexutil.Bytes
+	return result, c.callContext(ctx, &result, "recoverSignerKey", escrow, responses)
+}
+
+func (c *Client) AddTrustedSigner(ctx context.Context, attestation hexutil.Bytes) (common.Address, error) {
+	var result common.Address
+	return result, c.callContext(ctx, &result, "addTrustedSigner", attestation)
+}
+
+func (c *Client) RemoveTrustedSigner(ctx context.Context, signer common.Address) error {
+	return c.callContext(ctx, nil, "removeTrustedSigner", signer)
+}
+
+func (c *Client) TrustedSigners(ctx context.Context) ([]common.Address, error) {
+	var result []common.Address
+	return result, c.callContext(ctx, &result, "trustedSigners")
+}
+
+func (c *Client) ConfigAllowlist(ctx context.Context) (*ConfigAllowlist, error) {
+	var result ConfigAllowlist
+	return &result, c.callContext(ctx, &result, "configAllowlist")
+}
+
+func (c *Client) UpdateConfigAllowlist(ctx context.Context, update hexutil.Bytes) (hexutil.Bytes, error) {
 	var result hexutil.Bytes
-	return result, c.callContext(ctx, &result, "encryptedSignerKey", attestation)
+	return result, c.callContext(ctx, &result, "updateConfigAllowlist", update)
+}
+
+func (c *Client) SigningJournal(ctx context.Context) ([]*JournalSummary, error) {
+	var result []*JournalSummary
+	return result, c.callContext(ctx, &result, "signingJournal")
 }
 
-func (c *Client) SetSignerKey(ctx context.Context, encrypted hexutil.Bytes) error {
-	return c.callContext(ctx, nil, "setSignerKey", encrypted)
+func (c *Client) SignedOutputRoot(ctx context.Context, configHash common.Hash, number hexutil.Uint64) (*common.Hash, error) {
+	var result *common.Hash
+	return result, c.callContext(ctx, &result, "signedOutputRoot", configHash, number)
+}
+
+func (c *Client) ExportSigningJournal(ctx context.Context) (hexutil.Bytes, error) {
+	var result hexutil.Bytes
+	return result, c.callContext(ctx, &result, "exportSigningJournal")
+}
+
+func (c *Client) ImportSigningJournal(ctx context.Context, sealed hexutil.Bytes) error {
+	return c.callContext(ctx, nil, "importSigningJournal", sealed)
+}
+
+func (c *Client) WireFormats(ctx context.Context) ([]WireFormat, error) {
+	var result []WireFormat
+	return result, c.callContext(ctx, &result, "wireFormats")
+}
+
+func (c *Client) ExecuteStateless(ctx context.Context, config *PerChainConfig, l1Origin *types.Header, l1Receipts types.Receipts, previousBlockTxs []hexutil.Bytes, blockHeader *types.Header, sequencedTxs []hexutil.Bytes, witness *stateless.ExecutionWitness, messageAccount *eth.AccountResult, prevMessageAccount *eth.AccountResult) (*Proposal, error) {
+	format, err := c.wireFormat(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if format != WireFormatJSON {
+		result, err := c.executeStatelessBinary(ctx, format, config, prevMessageAccount, []*BlockInput{{
+			L1Origin:         l1Origin,
+			L1Receipts:       l1Receipts,
+			PreviousBlockTxs: previousBlockTxs,
+			BlockHeader:      blockHeader,
+			SequencedTxs:     sequencedTxs,
+			Witness:          witness,
+			MessageAccount:   messageAccount,
+		}})
+		if !c.binaryUnsupported(err) {
+			return result, err
+		}
+	}
+	var result Proposal
+	return &result, c.callContext(ctx, &result, "executeStateless", config, l1Origin, l1Receipts, previousBlockTxs, blockHeader, sequencedTxs, witness, messageAccount, prevMessageAccount)
+}
+
+func (c *Client) ExecuteStatelessRange(ctx context.Context, config *PerChainConfig, prevMessageAccount *eth.AccountResult, blocks []*BlockInput) (*Proposal, error) {
+	format, err := c.wireFormat(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if format != WireFormatJSON {
+		result, err := c.executeStatelessBinary(ctx, format, config, prevMessageAccount, blocks)
+		if !c.binaryUnsupported(err) {
+			return result, err
+		}
+	}
+	var result Proposal
+	return &result, c.callContext(ctx, &result, "executeStatelessRange", config, prevMessageAccount, blocks)
+}
+
+func (c *Client) executeStatelessBinary(ctx context.Context, format WireFormat, config *PerChainConfig, prevMessageAccount *eth.AccountResult, blocks []*BlockInput) (*Proposal, error) {
+	payload, err := EncodeExecuteStateless(format, config, prevMessageAccount, blocks)
+	if err != nil {
+		return nil, err
+	}
+	return c.ExecuteStatelessBinary(ctx, payload)
+}
+
+func (c *Client) ExecuteStatelessBinary(ctx context.Context, payload []byte) (*Proposal, error) {
+	var result Proposal
+	return &result, c.callContext(ctx, &result, "executeStatelessBinary", payload)
 }
 
-func (c *Client) ExecuteStateless(ctx context.Context, config *PerChainConfig, l1Origin *types.Header, l1Receipts types.Receipts, previousBlockTxs []hexutil.Bytes, blockHeader *types.Header, sequencedTxs []hexutil.Bytes, witness *stateless.ExecutionWitness, messageAccount *eth.AccountResult, prevMessageAccountHash common.Hash) (*Proposal, error) {
+func (c *Client) Aggregate(ctx context.Context, configHash common.Hash, prevOutputRoot common.Hash, proposals []*Proposal, config *PerChainConfig) (*Proposal, error) {
+	format, err := c.wireFormat(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if format != WireFormatJSON {
+		payload, err := EncodeAggregate(format, configHash, prevOutputRoot, proposals, config)
+		if err != nil {
+			return nil, err
+		}
+		result, err := c.AggregateBinary(ctx, payload)
+		if !c.binaryUnsupported(err) {
+			return result, err
+		}
+	}
 	var result Proposal
-	return &result, c.callContext(ctx, &result, "executeStateless", config, l1Origin, l1Receipts, previousBlockTxs, blockHeader, sequencedTxs, witness, messageAccount, prevMessageAccountHash)
+	// omit a missing config, as images before config version 2 do not take it
+	if config == nil {
+		return &result, c.callContext(ctx, &result, "aggregate", configHash, prevOutputRoot, proposals)
+	}
+	return &result, c.callContext(ctx, &result, "aggregate", configHash, prevOutputRoot, proposals, config)
 }
 
-func (c *Client) Aggregate(ctx context.Context, configHash common.Hash, prevOutputRoot common.Hash, proposals []*Proposal) (*Proposal, error) {
+func (c *Client) AggregateBinary(ctx context.Context, payload []byte) (*Proposal, error) {
 	var result Proposal
-	return &result, c.callContext(ctx, &result, "aggregate", configHash, prevOutputRoot, proposals)
+	return &result, c.callContext(ctx, &result, "aggregateBinary", payload)
 }
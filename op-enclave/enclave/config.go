@@ -2,22 +2,44 @@ package enclave
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"math/big"
 
+	"github.com/base/op-enclave/op-enclave/signing"
 	"github.com/ethereum-optimism/optimism/op-chain-ops/genesis"
 	"github.com/ethereum-optimism/optimism/op-node/rollup"
 	"github.com/ethereum-optimism/optimism/op-service/eth"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
 )
 
+// PerChainConfig versions
+//
+// Version 0 configs only contain the chain's genesis and addresses, and use the default
+// block time, derivation parameters and hardfork schedule. Version 1 configs also contain
+// these, so they can describe any chain, but have a different hash. The version is chosen
+// by the operator, as the config hash must match the one the OutputOracle verifies
+// proposals against: a chain deployed with a version 0 config hash keeps using version 0
+// until its OutputOracle is upgraded to the hash of its version 1 config, after which the
+// proposer is switched to version 1.
+//
+// Version 2 configs are version 1 configs with a SigningDomain, and proposals for them
+// are signed with EIP-712 typed data (signing.Version1) instead of the legacy packed
+// encoding, which the OutputOracle must verify.
 const (
 	version0 uint64 = 0
+	version1 uint64 = 1
+	version2 uint64 = 2
 )
 
+// supportedConfigVersions lists the PerChainConfig versions that this enclave can execute.
+var supportedConfigVersions = []uint64{version0, version1, version2}
+
 var (
 	l2GenesisBlockBaseFeePerGas = hexutil.Big(*(big.NewInt(1000000000)))
 	vaultMinWithdrawalAmount    = mustHexBigFromHex("0x8ac7230489e80000")
@@ -65,6 +87,9 @@ func NewChainConfig(cfg *PerChainConfig) *ChainConfig {
 	cfg.ForceDefaults()
 	chainConfig := chainConfigTemplate
 	chainConfig.ChainID = cfg.ChainID
+	if cfg.Hardforks != nil {
+		cfg.Hardforks.applyToChainConfig(&chainConfig)
+	}
 	return &ChainConfig{
 		ChainConfig:    &chainConfig,
 		PerChainConfig: cfg,
@@ -77,20 +102,117 @@ type PerChainConfig struct {
 	Genesis   rollup.Genesis `json:"genesis"`
 	BlockTime uint64         `json:"block_time"`
 
+	// Derivation parameters, which version 0 configs take from the default deploy config.
+	MaxSequencerDrift     uint64 `json:"max_sequencer_drift,omitempty"`
+	SeqWindowSize         uint64 `json:"seq_window_size,omitempty"`
+	ChannelTimeoutBedrock uint64 `json:"channel_timeout,omitempty"`
+
 	DepositContractAddress common.Address `json:"deposit_contract_address"`
 	L1SystemConfigAddress  common.Address `json:"l1_system_config_address"`
+
+	// Hardforks is the hardfork activation schedule. Configs without a schedule are
+	// version 0, which use the default schedule, a block time of 1 second, and the
+	// default derivation parameters.
+	Hardforks *Hardforks `json:"hardforks,omitempty"`
+
+	// SigningDomain is the EIP-712 domain of the chain's proposals. Configs with a
+	// domain are version 2, and require a hardfork schedule.
+	SigningDomain *SigningDomain `json:"signing_domain,omitempty"`
+}
+
+// SigningDomain identifies the L1 chain and OutputOracle contract that proposals are
+// signed for, in addition to the L2 chain ID of the config.
+type SigningDomain struct {
+	L1ChainID    *big.Int       `json:"l1_chain_id"`
+	OutputOracle common.Address `json:"output_oracle"`
 }
 
-func FromRollupConfig(cfg *rollup.Config) *PerChainConfig {
+// FromRollupConfig returns the PerChainConfig of the given version for the rollup config.
+// Version 0 configs ignore the parameters of the rollup config that they do not contain
+// (see Version0Compatible). The OutputOracle address is only used by version 2 configs,
+// for their signing domain.
+func FromRollupConfig(cfg *rollup.Config, version uint64, outputOracle common.Address) (*PerChainConfig, error) {
 	p := &PerChainConfig{
 		ChainID:                cfg.L2ChainID,
 		Genesis:                cfg.Genesis,
 		BlockTime:              cfg.BlockTime,
+		MaxSequencerDrift:      cfg.MaxSequencerDrift,
+		SeqWindowSize:          cfg.SeqWindowSize,
+		ChannelTimeoutBedrock:  cfg.ChannelTimeoutBedrock,
 		DepositContractAddress: cfg.DepositContractAddress,
 		L1SystemConfigAddress:  cfg.L1SystemConfigAddress,
 	}
+	switch version {
+	case version0:
+	case version1:
+		p.Hardforks = hardforksFromRollupConfig(cfg)
+	case version2:
+		p.Hardforks = hardforksFromRollupConfig(cfg)
+		p.SigningDomain = &SigningDomain{
+			L1ChainID:    cfg.L1ChainID,
+			OutputOracle: outputOracle,
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config version: %d", version)
+	}
 	p.ForceDefaults()
-	return p
+	return p, nil
+}
+
+// Version0Compatible returns true if the rollup config uses the block time, derivation
+// parameters and hardfork schedule of version 0 configs, so that executing it with a
+// version 0 config is correct.
+func Version0Compatible(cfg *rollup.Config) bool {
+	return cfg.BlockTime == 1 &&
+		cfg.MaxSequencerDrift == rollupConfigTemplate.MaxSequencerDrift &&
+		cfg.SeqWindowSize == rollupConfigTemplate.SeqWindowSize &&
+		cfg.ChannelTimeoutBedrock == rollupConfigTemplate.ChannelTimeoutBedrock &&
+		hardforksFromRollupConfig(cfg).Equal(defaultHardforks())
+}
+
+// Version returns the version of the config, which determines its binary encoding.
+func (p *PerChainConfig) Version() uint64 {
+	if p.SigningDomain != nil {
+		return version2
+	}
+	if p.Hardforks != nil {
+		return version1
+	}
+	return version0
+}
+
+// Check returns an error if the config cannot be executed.
+func (p *PerChainConfig) Check() error {
+	if p.ChainID == nil {
+		return errors.New("missing chain ID")
+	}
+	if p.SigningDomain != nil {
+		if p.Hardforks == nil {
+			return errors.New("signing domain requires a hardfork schedule")
+		}
+		if p.SigningDomain.L1ChainID == nil || p.SigningDomain.L1ChainID.Sign() <= 0 {
+			return errors.New("missing L1 chain ID in signing domain")
+		}
+		if p.SigningDomain.OutputOracle == (common.Address{}) {
+			return errors.New("missing OutputOracle address in signing domain")
+		}
+	}
+	if p.Hardforks == nil {
+		return nil
+	}
+	if p.BlockTime == 0 {
+		return errors.New("block time must be greater than 0")
+	}
+	if p.MaxSequencerDrift == 0 {
+		return errors.New("max sequencer drift must be greater than 0")
+	}
+	if p.SeqWindowSize < 2 {
+		return errors.New("sequencer window size must be at least 2")
+	}
+	if p.ChannelTimeoutBedrock == 0 {
+		return errors.New("channel timeout must be greater than 0")
+	}
+	return p.Hardforks.Check()
 }
 
 func (p *PerChainConfig) ToRollupConfig() *rollup.Config {
@@ -98,13 +220,24 @@ func (p *PerChainConfig) ToRollupConfig() *rollup.Config {
 	cfg.L2ChainID = p.ChainID
 	cfg.Genesis = p.Genesis
 	cfg.BlockTime = p.BlockTime
+	cfg.MaxSequencerDrift = p.MaxSequencerDrift
+	cfg.SeqWindowSize = p.SeqWindowSize
+	cfg.ChannelTimeoutBedrock = p.ChannelTimeoutBedrock
 	cfg.DepositContractAddress = p.DepositContractAddress
 	cfg.L1SystemConfigAddress = p.L1SystemConfigAddress
+	if p.Hardforks != nil {
+		p.Hardforks.applyToRollupConfig(&cfg)
+	}
 	return &cfg
 }
 
 func (p *PerChainConfig) ForceDefaults() {
-	p.BlockTime = 1
+	if p.Hardforks == nil {
+		p.BlockTime = 1
+		p.MaxSequencerDrift = rollupConfigTemplate.MaxSequencerDrift
+		p.SeqWindowSize = rollupConfigTemplate.SeqWindowSize
+		p.ChannelTimeoutBedrock = rollupConfigTemplate.ChannelTimeoutBedrock
+	}
 	p.Genesis.L2.Number = 0
 	p.Genesis.SystemConfig.Overhead = eth.Bytes32{}
 }
@@ -114,7 +247,8 @@ func (p *PerChainConfig) Hash() common.Hash {
 }
 
 func (p *PerChainConfig) MarshalBinary() (data []byte) {
-	data = binary.BigEndian.AppendUint64(data, version0)
+	version := p.Version()
+	data = binary.BigEndian.AppendUint64(data, version)
 	chainIDBytes := p.ChainID.Bytes()
 	data = append(data, make([]byte, 32-len(chainIDBytes))...)
 	data = append(data, chainIDBytes...)
@@ -126,7 +260,32 @@ func (p *PerChainConfig) MarshalBinary() (data []byte) {
 	data = binary.BigEndian.AppendUint64(data, p.Genesis.SystemConfig.GasLimit)
 	data = append(data, p.DepositContractAddress.Bytes()...)
 	data = append(data, p.L1SystemConfigAddress.Bytes()...)
-	return data
+	if version == version0 {
+		return data
+	}
+	data = binary.BigEndian.AppendUint64(data, p.BlockTime)
+	data = binary.BigEndian.AppendUint64(data, p.MaxSequencerDrift)
+	data = binary.BigEndian.AppendUint64(data, p.SeqWindowSize)
+	data = binary.BigEndian.AppendUint64(data, p.ChannelTimeoutBedrock)
+	data = p.Hardforks.appendBinary(data)
+	if version == version1 {
+		return data
+	}
+	data = append(data, math.U256Bytes(new(big.Int).Set(p.SigningDomain.L1ChainID))...)
+	return append(data, p.SigningDomain.OutputOracle.Bytes()...)
+}
+
+// Signing returns the scheme and domain that proposals for the config are signed with:
+// EIP-712 typed data for configs with a SigningDomain, and the legacy encoding otherwise.
+func (p *PerChainConfig) Signing() (signing.Version, *signing.Domain) {
+	if p.SigningDomain == nil {
+		return signing.Version0, nil
+	}
+	return signing.Version1, &signing.Domain{
+		L1ChainID:    p.SigningDomain.L1ChainID,
+		L2ChainID:    p.ChainID,
+		OutputOracle: p.SigningDomain.OutputOracle,
+	}
 }
 
 func DefaultDeployConfig() genesis.DeployConfig {
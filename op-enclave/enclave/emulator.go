@@ -0,0 +1,269 @@
+package enclave
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	emulatorModuleID  = "i-00000000000000000-enc0000000000000000"
+	emulatorPCRCount  = 16
+	emulatorPCRLength = sha512.Size384
+	emulatorSigLength = 96 // r || s for P-384
+	emulatorCertTTL   = 3 * time.Hour
+	emulatorCASeed    = "op-enclave attestation emulator CA"
+)
+
+var (
+	emulatorRoot     = sync.OnceValues(createEmulatorRoot)
+	emulatorNotAfter = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+type emulatorCA struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+	der  []byte
+}
+
+// createEmulatorRoot creates the self-signed emulator root certificate. The CA key is
+// derived deterministically, so that separate emulator instances trust each other.
+func createEmulatorRoot() (*emulatorCA, error) {
+	curve := elliptic.P384()
+	seed := sha512.Sum384([]byte(emulatorCASeed))
+	d := new(big.Int).SetBytes(seed[:])
+	d.Mod(d, new(big.Int).Sub(curve.Params().N, big.NewInt(1)))
+	d.Add(d, big.NewInt(1))
+	key := &ecdsa.PrivateKey{D: d}
+	key.PublicKey.Curve = curve
+	key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(d.Bytes())
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "op-enclave emulator root"},
+		NotBefore:             time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              emulatorNotAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SignatureAlgorithm:    x509.ECDSAWithSHA384,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create emulator root certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse emulator root certificate: %w", err)
+	}
+	return &emulatorCA{
+		key:  key,
+		cert: cert,
+		der:  der,
+	}, nil
+}
+
+// EmulatorRoots returns a CertPool containing the root certificate used by
+// EmulatedAttestor, for verifying emulated attestation documents.
+func EmulatorRoots() (*x509.CertPool, error) {
+	ca, err := emulatorRoot()
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool, nil
+}
+
+// EmulatedAttestor is a software implementation of Attestor, for running outside of a
+// Nitro Enclave. It produces attestation documents with the same structure as the Nitro
+// Secure Module, signed by a test CA (see EmulatorRoots) instead of the AWS root.
+type EmulatedAttestor struct {
+	ca    *emulatorCA
+	roots *x509.CertPool
+	pcrs  map[uint][]byte
+	mutex sync.Mutex
+	cert  []byte
+	key   *ecdsa.PrivateKey
+	until time.Time
+}
+
+var _ Attestor = (*EmulatedAttestor)(nil)
+
+// NewEmulatedAttestor creates an EmulatedAttestor that reports the given PCR values.
+// PCRs that are not provided are reported as all zeroes, matching a debug-mode enclave.
+func NewEmulatedAttestor(pcrs map[uint][]byte) (*EmulatedAttestor, error) {
+	ca, err := emulatorRoot()
+	if err != nil {
+		return nil, err
+	}
+	roots, err := EmulatorRoots()
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[uint][]byte, emulatorPCRCount)
+	for i := uint(0); i < emulatorPCRCount; i++ {
+		values[i] = make([]byte, emulatorPCRLength)
+	}
+	for i, pcr := range pcrs {
+		if i >= 32 {
+			return nil, fmt.Errorf("invalid PCR index: %d", i)
+		}
+		if len(pcr) != 32 && len(pcr) != 48 && len(pcr) != 64 {
+			return nil, fmt.Errorf("invalid PCR%d length: %d", i, len(pcr))
+		}
+		values[i] = pcr
+	}
+	return &EmulatedAttestor{
+		ca:    ca,
+		roots: roots,
+		pcrs:  values,
+	}, nil
+}
+
+func (e *EmulatedAttestor) Read(p []byte) (int, error) {
+	return rand.Read(p)
+}
+
+func (e *EmulatedAttestor) PCR(index uint) ([]byte, error) {
+	pcr, ok := e.pcrs[index]
+	if !ok {
+		return nil, fmt.Errorf("PCR%d not found", index)
+	}
+	return pcr, nil
+}
+
+func (e *EmulatedAttestor) Roots() *x509.CertPool {
+	return e.roots
+}
+
+func (e *EmulatedAttestor) Local() bool {
+	return true
+}
+
+type emulatorDocument struct {
+	ModuleID    string          `cbor:"module_id"`
+	Digest      string          `cbor:"digest"`
+	Timestamp   uint64          `cbor:"timestamp"`
+	PCRs        map[uint][]byte `cbor:"pcrs"`
+	Certificate []byte          `cbor:"certificate"`
+	CABundle    [][]byte        `cbor:"cabundle"`
+	PublicKey   []byte          `cbor:"public_key"`
+	UserData    []byte          `cbor:"user_data"`
+	Nonce       []byte          `cbor:"nonce"`
+}
+
+type coseHeader struct {
+	Alg int64 `cbor:"1,keyasint"`
+}
+
+type coseSign1 struct {
+	_ struct{} `cbor:",toarray"`
+
+	Protected   []byte
+	Unprotected cbor.RawMessage
+	Payload     []byte
+	Signature   []byte
+}
+
+type coseSigStructure struct {
+	_ struct{} `cbor:",toarray"`
+
+	Context     string
+	Protected   []byte
+	ExternalAAD []byte
+	Payload     []byte
+}
+
+func (e *EmulatedAttestor) Attest(publicKey, userData, nonce []byte) ([]byte, error) {
+	now := time.Now()
+	cert, key, err := e.certificate(now)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := cbor.Marshal(&emulatorDocument{
+		ModuleID:    emulatorModuleID,
+		Digest:      "SHA384",
+		Timestamp:   uint64(now.UnixMilli()),
+		PCRs:        e.pcrs,
+		Certificate: cert,
+		CABundle:    [][]byte{e.ca.der},
+		PublicKey:   publicKey,
+		UserData:    userData,
+		Nonce:       nonce,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode attestation document: %w", err)
+	}
+	protected, err := cbor.Marshal(&coseHeader{
+		Alg: -35, // ES384
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode COSE header: %w", err)
+	}
+	sigStructure, err := cbor.Marshal(&coseSigStructure{
+		Context:     "Signature1",
+		Protected:   protected,
+		ExternalAAD: []byte{},
+		Payload:     payload,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode COSE signature structure: %w", err)
+	}
+	digest := sha512.Sum384(sigStructure)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign attestation document: %w", err)
+	}
+	signature := make([]byte, emulatorSigLength)
+	r.FillBytes(signature[:emulatorSigLength/2])
+	s.FillBytes(signature[emulatorSigLength/2:])
+	return cbor.Marshal(&coseSign1{
+		Protected:   protected,
+		Unprotected: cbor.RawMessage{0xa0}, // empty map
+		Payload:     payload,
+		Signature:   signature,
+	})
+}
+
+// certificate returns the current leaf certificate and key, issuing a new pair from the
+// emulator CA if the previous one is close to expiry.
+func (e *EmulatedAttestor) certificate(now time.Time) ([]byte, *ecdsa.PrivateKey, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.cert != nil && now.Add(emulatorCertTTL/2).Before(e.until) {
+		return e.cert, e.key, nil
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate emulator certificate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	until := now.Add(emulatorCertTTL)
+	template := &x509.Certificate{
+		SerialNumber:       serial,
+		Subject:            pkix.Name{CommonName: emulatorModuleID},
+		NotBefore:          now.Add(-time.Minute),
+		NotAfter:           until,
+		KeyUsage:           x509.KeyUsageDigitalSignature,
+		SignatureAlgorithm: x509.ECDSAWithSHA384,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, e.ca.cert, &key.PublicKey, e.ca.key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create emulator certificate: %w", err)
+	}
+	e.cert, e.key, e.until = cert, key, until
+	return cert, key, nil
+}
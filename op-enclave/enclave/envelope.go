@@ -0,0 +1,146 @@
+package enclave
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"github.com/base/op-enclave/op-enclave/signing"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Response envelopes
+//
+// Each proposal signed by the enclave carries an Envelope, signed by the same key, that
+// binds the proposal signature to a digest of every input of the request, the enclave's
+// PCR0, its instance ID and a sequence number. Hosts store the envelopes, so that an
+// output root submitted onchain can be traced to the exact inputs and enclave image that
+// produced it. The sequence number is kept in memory, and restarts from 1 with the
+// enclave, so envelopes are identified by the instance ID, which is generated randomly
+// on every start, together with the sequence number.
+//
+// Request digests are computed from the decoded inputs, so they do not depend on the
+// wire format of the request: an ExecuteStatelessRange request is hashed as the RLP
+// encoding of the config hash, the previous message account and the blocks (with sorted
+// witness codes and state), and an Aggregate request as the RLP encoding of the config
+// hash, the previous output root and the proposals.
+const (
+	executionRequestTag   = "op-enclave/request/execute"
+	aggregationRequestTag = "op-enclave/request/aggregate"
+)
+
+// Envelope is the signed record of how a Proposal was produced (see signing.Envelope).
+type Envelope struct {
+	RequestDigest common.Hash
+	PCR0          hexutil.Bytes
+	InstanceID    common.Hash
+	Sequence      hexutil.Uint64
+	Signature     hexutil.Bytes
+}
+
+type executionRequest struct {
+	ConfigHash         common.Hash
+	PrevMessageAccount *wireAccountResult `rlp:"nil"`
+	Blocks             []*wireBlockInput
+}
+
+// executionRequestDigest returns the digest of an ExecuteStatelessRange request.
+func executionRequestDigest(configHash common.Hash, prevMessageAccount *eth.AccountResult, blocks []*statelessInput) (common.Hash, error) {
+	request := &executionRequest{
+		ConfigHash:         configHash,
+		PrevMessageAccount: toWireAccountResult(prevMessageAccount),
+		Blocks:             make([]*wireBlockInput, len(blocks)),
+	}
+	for i, block := range blocks {
+		request.Blocks[i] = &wireBlockInput{
+			L1Origin:         block.L1Origin,
+			L1Receipts:       block.L1Receipts,
+			PreviousBlockTxs: fromHexBytes(block.PreviousBlockTxs),
+			BlockHeader:      block.BlockHeader,
+			SequencedTxs:     fromHexBytes(block.SequencedTxs),
+			Witness: &wireWitness{
+				Headers: block.witness.Headers,
+				Codes:   sortedSet(block.witness.Codes),
+				State:   sortedSet(block.witness.State),
+			},
+			MessageAccount: toWireAccountResult(block.MessageAccount),
+			L1OriginChain:  toWireL1Blocks(block.L1OriginChain),
+		}
+	}
+	return requestDigest(executionRequestTag, request)
+}
+
+// aggregationRequestDigest returns the digest of an Aggregate request.
+func aggregationRequestDigest(configHash common.Hash, prevOutputRoot common.Hash, proposals []*Proposal) (common.Hash, error) {
+	request := &wireAggregate{
+		ConfigHash:     configHash,
+		PrevOutputRoot: prevOutputRoot,
+		Proposals:      make([]*wireProposal, len(proposals)),
+	}
+	for i, p := range proposals {
+		request.Proposals[i] = &wireProposal{
+			OutputRoot:    p.OutputRoot,
+			Signature:     p.Signature,
+			L1OriginHash:  p.L1OriginHash,
+			L2BlockNumber: p.L2BlockNumber.ToInt(),
+		}
+	}
+	return requestDigest(aggregationRequestTag, request)
+}
+
+func requestDigest(tag string, request interface{}) (common.Hash, error) {
+	hasher := crypto.NewKeccakState()
+	hasher.Write([]byte(tag))
+	if err := rlp.Encode(hasher, request); err != nil {
+		return common.Hash{}, fmt.Errorf("failed to encode request: %w", err)
+	}
+	var digest common.Hash
+	hasher.Read(digest[:])
+	return digest, nil
+}
+
+func sortedSet(set map[string]struct{}) [][]byte {
+	values := make([][]byte, 0, len(set))
+	for value := range set {
+		values = append(values, []byte(value))
+	}
+	slices.SortFunc(values, bytes.Compare)
+	return values
+}
+
+// signProposal signs the proposal, and its envelope for the request with the given
+// digest, with the same signer key.
+func (s *Server) signProposal(version signing.Version, domain *signing.Domain, p *signing.Proposal, requestDigest common.Hash) (*Proposal, error) {
+	key := s.signer.get()
+	sig, err := signing.Sign(version, domain, p, key)
+	if err != nil {
+		return nil, err
+	}
+	envelope := &signing.Envelope{
+		RequestDigest: requestDigest,
+		PCR0:          s.pcr0,
+		InstanceID:    s.instanceID,
+		Sequence:      s.sequence.Add(1),
+	}
+	envelopeSig, err := signing.SignEnvelope(sig, envelope, key)
+	if err != nil {
+		return nil, err
+	}
+	return &Proposal{
+		OutputRoot:    p.OutputRoot,
+		Signature:     sig,
+		L1OriginHash:  p.L1OriginHash,
+		L2BlockNumber: (*hexutil.Big)(p.L2BlockNumber),
+		Envelope: &Envelope{
+			RequestDigest: requestDigest,
+			PCR0:          s.pcr0,
+			InstanceID:    s.instanceID,
+			Sequence:      hexutil.Uint64(envelope.Sequence),
+			Signature:     envelopeSig,
+		},
+	}, nil
+}
@@ -0,0 +1,59 @@
+package enclave
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/base/op-enclave/op-enclave/signing"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestSignProposalEnvelope(t *testing.T) {
+	// two instances of the same image with the same signer key, e.g. after a key
+	// transfer or a restart, sign the same proposal with the same sequence number
+	first := newTestServer(t, testPCRs(1))
+	second := newTestServer(t, testPCRs(1))
+	if err := second.signer.set(first.signer.get()); err != nil {
+		t.Fatal(err)
+	}
+	p := &signing.Proposal{
+		ConfigHash:     common.Hash{1},
+		L1OriginHash:   common.Hash{2},
+		L2BlockNumber:  big.NewInt(3),
+		PrevOutputRoot: common.Hash{4},
+		OutputRoot:     common.Hash{5},
+	}
+
+	envelopes := make([]*signing.Envelope, 2)
+	for i, s := range []*Server{first, second} {
+		proposal, err := s.signProposal(signing.Version0, nil, p, common.Hash{6})
+		if err != nil {
+			t.Fatalf("signProposal: %v", err)
+		}
+		e := proposal.Envelope
+		if e.InstanceID != s.instanceID || e.Sequence != 1 {
+			t.Fatalf("unexpected envelope instance %s sequence %d", e.InstanceID, e.Sequence)
+		}
+		envelopes[i] = &signing.Envelope{
+			RequestDigest: e.RequestDigest,
+			PCR0:          e.PCR0,
+			InstanceID:    e.InstanceID,
+			Sequence:      uint64(e.Sequence),
+		}
+		signer, err := signing.RecoverEnvelope(proposal.Signature, envelopes[i], e.Signature)
+		if err != nil {
+			t.Fatalf("RecoverEnvelope: %v", err)
+		}
+		if signer != crypto.PubkeyToAddress(s.signer.get().PublicKey) {
+			t.Fatalf("envelope signer %s is not the proposal signer", signer)
+		}
+	}
+	sig, err := signing.Sign(signing.Version0, nil, p, first.signer.get())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signing.EnvelopeHash(sig, envelopes[0]) == signing.EnvelopeHash(sig, envelopes[1]) {
+		t.Fatal("envelopes of different enclave instances are not distinct")
+	}
+}
@@ -0,0 +1,149 @@
+package enclave
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrorCode is a JSON-RPC error code returned by the enclave. Codes are stable, so
+// clients can use them to decide how to handle a failure.
+type ErrorCode int
+
+const (
+	// ErrorCodeInternal is an unexpected failure inside the enclave. The request can be retried.
+	ErrorCodeInternal ErrorCode = -39000
+	// ErrorCodeInvalidRequest means the request could not be decoded.
+	ErrorCodeInvalidRequest ErrorCode = -39001
+	// ErrorCodeInputMismatch means the inputs are inconsistent with the block headers they
+	// are committed to, e.g. receipts, transactions, witness or proofs. The inputs should
+	// be fetched again.
+	ErrorCodeInputMismatch ErrorCode = -39002
+	// ErrorCodeInvalidBlock means the block failed validation against correct inputs, e.g.
+	// due to a reorg. Proofs building on the block should be dropped.
+	ErrorCodeInvalidBlock ErrorCode = -39003
+	// ErrorCodeInvalidProposal means a proposal passed to Aggregate was not signed by
+	// this enclave, or does not chain. The proposals should be dropped.
+	ErrorCodeInvalidProposal ErrorCode = -39004
+	// ErrorCodeUnauthorized means the request is not permitted, e.g. the chain config
+	// is not allowlisted.
+	ErrorCodeUnauthorized ErrorCode = -39005
+	// ErrorCodeEquivocation means the enclave has already signed a different output root
+	// for the block, or the block is older than its signing journal. The proposals should
+	// be dropped.
+	ErrorCodeEquivocation ErrorCode = -39006
+	// ErrorCodeLimitExceeded means the request exceeded a resource limit of the enclave,
+	// e.g. the witness size or execution deadline. The check identifies the limit.
+	ErrorCodeLimitExceeded ErrorCode = -39007
+
+	minErrorCode = ErrorCodeLimitExceeded
+	maxErrorCode = ErrorCodeInternal
+)
+
+// Error is an enclave failure, which is returned to clients as a JSON-RPC error
+// with ErrorData attached.
+type Error struct {
+	Code     ErrorCode
+	Check    string
+	Message  string
+	Expected *common.Hash
+	Actual   *common.Hash
+	Err      error
+}
+
+var (
+	_ rpc.Error     = (*Error)(nil)
+	_ rpc.DataError = (*Error)(nil)
+)
+
+// ErrorData is the machine-readable data of an Error.
+type ErrorData struct {
+	// Check identifies the check that failed, e.g. "state_root".
+	Check    string       `json:"check"`
+	Expected *common.Hash `json:"expected,omitempty"`
+	Actual   *common.Hash `json:"actual,omitempty"`
+}
+
+func newError(code ErrorCode, check string, message string) *Error {
+	return &Error{
+		Code:    code,
+		Check:   check,
+		Message: message,
+	}
+}
+
+func newMismatchError(code ErrorCode, check string, message string, expected, actual common.Hash) *Error {
+	return &Error{
+		Code:     code,
+		Check:    check,
+		Message:  message,
+		Expected: &expected,
+		Actual:   &actual,
+	}
+}
+
+func wrapError(code ErrorCode, check string, message string, err error) *Error {
+	return &Error{
+		Code:    code,
+		Check:   check,
+		Message: message,
+		Err:     err,
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) ErrorCode() int {
+	return int(e.Code)
+}
+
+func (e *Error) ErrorData() interface{} {
+	return &ErrorData{
+		Check:    e.Check,
+		Expected: e.Expected,
+		Actual:   e.Actual,
+	}
+}
+
+// ParseError extracts an enclave Error from an error returned by the Client. It
+// returns nil if err is not an enclave error.
+func ParseError(err error) *Error {
+	var enclaveErr *Error
+	if errors.As(err, &enclaveErr) {
+		return enclaveErr
+	}
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) {
+		return nil
+	}
+	code := ErrorCode(rpcErr.ErrorCode())
+	if code < minErrorCode || code > maxErrorCode {
+		return nil
+	}
+	parsed := &Error{
+		Code:    code,
+		Message: rpcErr.Error(),
+	}
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		// the client decodes data into generic JSON values, so round trip it
+		var data ErrorData
+		if raw, err := json.Marshal(dataErr.ErrorData()); err == nil && json.Unmarshal(raw, &data) == nil {
+			parsed.Check = data.Check
+			parsed.Expected = data.Expected
+			parsed.Actual = data.Actual
+		}
+	}
+	return parsed
+}
@@ -0,0 +1,355 @@
+package enclave
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Signer key escrow
+//
+// EscrowSignerKey splits the signer key into Shamir shares, any threshold of which
+// reconstruct it, and ECIES-encrypts each share to the decryption key of a different
+// custodian enclave, given as its DecryptionAttestation. The escrow only contains
+// ciphertexts, and is stored by the host. It is attested by the escrowing enclave,
+// binding the signer public key and the encrypted shares, so that only a key generated
+// in an enclave can be restored from it.
+//
+// To recover the key, a fresh enclave calls KeyTransferRequest, and the request is
+// passed with the escrow to EscrowShare on at least threshold custodians. Each custodian
+// verifies both, decrypts its share, and re-encrypts it to the request's ephemeral key,
+// with an attestation that echoes the nonce and commits to the transcript hash, as in
+// EncryptedSignerKey. RecoverSignerKey verifies the responses, combines the shares and
+// checks that the result is the escrowed key.
+//
+// Custodians release their share to any enclave accepted by the attestation policy, and
+// cannot tell whether the escrowing enclave is still running, so the recovered key never
+// signs new proposals: the recovering enclave rotates to a fresh signer key, which must
+// be registered like any new signer, and keeps the recovered key only for its overlap
+// period, to aggregate proposals it signed and import its signing journal. Otherwise a
+// host could recover the key into a second enclave while the first is still running,
+// and sign conflicting output roots with the same key.
+//
+// Custodian decryption keys are only held in memory, so a share is lost with its
+// custodian, and the key should be escrowed again when custodians are replaced. The
+// signing journal is not escrowed: it should be exported with ExportSigningJournal, and
+// imported into the recovered enclave with ImportSigningJournal, so that its new signer
+// key cannot sign output roots that conflict with the recovered key's.
+const (
+	escrowVersion1         uint64 = 1
+	maxEscrowCustodians           = 16
+	escrowDigestTag               = "op-enclave/escrow/digest"
+	escrowShareTag                = "op-enclave/escrow/share"
+	escrowShareResponseTag        = "op-enclave/escrow/share-response"
+)
+
+// decryptionAttestationTag is the user data of decryption key attestations, which
+// distinguishes them from attestations of other keys of the enclave, so that shares are
+// only escrowed to decryption keys.
+const decryptionAttestationTag = "op-enclave/decryption-key"
+
+type signerKeyEscrow struct {
+	Version     uint64
+	Signer      []byte
+	Threshold   uint64
+	Shares      []*escrowShare
+	Attestation []byte
+}
+
+type escrowShare struct {
+	Custodian  []byte
+	Ciphertext []byte
+}
+
+type escrowShareResponse struct {
+	Version     uint64
+	Attestation []byte
+	Ciphertext  []byte
+}
+
+// digest commits to the escrow, excluding its attestation.
+func (e *signerKeyEscrow) digest() common.Hash {
+	data := binary.BigEndian.AppendUint64([]byte(escrowDigestTag), e.Version)
+	data = append(data, crypto.Keccak256(e.Signer)...)
+	data = binary.BigEndian.AppendUint64(data, e.Threshold)
+	for _, share := range e.Shares {
+		data = append(data, crypto.Keccak256(share.Custodian)...)
+		data = append(data, crypto.Keccak256(share.Ciphertext)...)
+	}
+	return crypto.Keccak256Hash(data)
+}
+
+func (e *signerKeyEscrow) signerAddress() common.Address {
+	return common.BytesToAddress(crypto.Keccak256(e.Signer[1:])[12:])
+}
+
+// shareContext is the ECIES shared info of the share at index, which binds the
+// ciphertext to the escrowed key and its position.
+func (e *signerKeyEscrow) shareContext(index int) []byte {
+	data := binary.BigEndian.AppendUint64([]byte(escrowShareTag), e.Version)
+	data = append(data, crypto.Keccak256(e.Signer)...)
+	data = binary.BigEndian.AppendUint64(data, e.Threshold)
+	return binary.BigEndian.AppendUint64(data, uint64(index))
+}
+
+func escrowShareTranscript(version uint64, escrow common.Hash, request common.Hash, nonce []byte, ciphertext []byte) common.Hash {
+	data := binary.BigEndian.AppendUint64([]byte(escrowShareResponseTag), version)
+	data = append(data, escrow[:]...)
+	data = append(data, request[:]...)
+	data = append(data, crypto.Keccak256(nonce)...)
+	data = append(data, crypto.Keccak256(ciphertext)...)
+	return crypto.Keccak256Hash(data)
+}
+
+// decodeEscrow decodes and verifies an escrow, returning it with its digest.
+func (s *Server) decodeEscrow(data []byte) (*signerKeyEscrow, common.Hash, error) {
+	var escrow signerKeyEscrow
+	if err := rlp.DecodeBytes(data, &escrow); err != nil {
+		return nil, common.Hash{}, fmt.Errorf("failed to decode escrow: %w", err)
+	}
+	if escrow.Version != escrowVersion1 {
+		return nil, common.Hash{}, fmt.Errorf("unsupported escrow version: %d", escrow.Version)
+	}
+	if escrow.Threshold < 1 || escrow.Threshold > uint64(len(escrow.Shares)) || len(escrow.Shares) > maxEscrowCustodians {
+		return nil, common.Hash{}, errors.New("invalid escrow threshold")
+	}
+	if _, err := crypto.UnmarshalPubkey(escrow.Signer); err != nil {
+		return nil, common.Hash{}, fmt.Errorf("invalid escrow signer key: %w", err)
+	}
+	digest := escrow.digest()
+	// the escrow is verified long after it was attested
+	verification, err := s.verifier.verifyArchived(escrow.Attestation, digest[:], nil)
+	if err != nil {
+		return nil, common.Hash{}, fmt.Errorf("failed to verify escrow: %w", err)
+	}
+	if !bytes.Equal(verification.Document.PublicKey, escrow.Signer) {
+		return nil, common.Hash{}, errors.New("escrow attestation does not match the signer key")
+	}
+	return &escrow, digest, nil
+}
+
+// EscrowSignerKey splits the signer key into shares for the custodians, given as their
+// DecryptionAttestation, any threshold of which can recover it.
+func (s *Server) EscrowSignerKey(ctx context.Context, threshold hexutil.Uint64, custodians []hexutil.Bytes) (hexutil.Bytes, error) {
+	if len(custodians) == 0 || len(custodians) > maxEscrowCustodians {
+		return nil, fmt.Errorf("escrow requires 1 to %d custodians", maxEscrowCustodians)
+	}
+	if threshold < 1 || int(threshold) > len(custodians) {
+		return nil, fmt.Errorf("invalid threshold %d of %d custodians", threshold, len(custodians))
+	}
+	keys := make([]*ecdsa.PublicKey, len(custodians))
+	seen := make(map[common.Address]bool, len(custodians))
+	for i, attestation := range custodians {
+		verification, err := s.verifier.verify(attestation, []byte(decryptionAttestationTag), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify custodian %d: %w", i, err)
+		}
+		public, err := crypto.UnmarshalPubkey(verification.Document.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse custodian %d public key: %w", i, err)
+		}
+		address := crypto.PubkeyToAddress(*public)
+		if seen[address] {
+			return nil, fmt.Errorf("duplicate custodian %d", i)
+		}
+		seen[address] = true
+		keys[i] = public
+	}
+
+	signerKey := s.signer.get()
+	shares, err := shamirSplit(crypto.FromECDSA(signerKey), len(custodians), int(threshold), s.attestor)
+	if err != nil {
+		return nil, err
+	}
+	escrow := &signerKeyEscrow{
+		Version:   escrowVersion1,
+		Signer:    crypto.FromECDSAPub(&signerKey.PublicKey),
+		Threshold: uint64(threshold),
+		Shares:    make([]*escrowShare, len(custodians)),
+	}
+	for i, share := range shares {
+		ciphertext, err := ecies.Encrypt(s.attestor, ecies.ImportECDSAPublic(keys[i]), share, escrow.shareContext(i), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt share %d: %w", i, err)
+		}
+		escrow.Shares[i] = &escrowShare{
+			Custodian:  crypto.FromECDSAPub(keys[i]),
+			Ciphertext: ciphertext,
+		}
+	}
+	digest := escrow.digest()
+	if escrow.Attestation, err = s.attestor.Attest(escrow.Signer, digest[:], nil); err != nil {
+		return nil, fmt.Errorf("failed to attest escrow: %w", err)
+	}
+	log.Info("Escrowed signer key", "address", crypto.PubkeyToAddress(signerKey.PublicKey).Hex(),
+		"threshold", threshold, "custodians", len(custodians))
+	return rlp.EncodeToBytes(escrow)
+}
+
+// EscrowShare decrypts this custodian's share of the escrow, and encrypts it for the
+// enclave that produced the given KeyTransferRequest attestation.
+func (s *Server) EscrowShare(ctx context.Context, escrow hexutil.Bytes, request hexutil.Bytes) (hexutil.Bytes, error) {
+	e, escrowDigest, err := s.decodeEscrow(escrow)
+	if err != nil {
+		return nil, err
+	}
+	own := crypto.FromECDSAPub(&s.decryptionKey.PublicKey)
+	index := -1
+	for i, share := range e.Shares {
+		if bytes.Equal(share.Custodian, own) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, errors.New("this enclave is not a custodian of the escrow")
+	}
+	share, err := ecies.ImportECDSA(s.decryptionKey).Decrypt(e.Shares[index].Ciphertext, e.shareContext(index), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt share: %w", err)
+	}
+
+	verification, err := s.verifier.verify(request, keyTransferRequestUserData(keyTransferVersion2), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify key transfer request: %w", err)
+	}
+	doc := verification.Document
+	if len(doc.Nonce) != keyTransferNonceSize {
+		return nil, errors.New("key transfer request has an invalid nonce")
+	}
+	public, err := crypto.UnmarshalPubkey(doc.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	requestHash := crypto.Keccak256Hash(request)
+	ciphertext, err := ecies.Encrypt(s.attestor, ecies.ImportECDSAPublic(public), share, requestHash[:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt share: %w", err)
+	}
+	transcript := escrowShareTranscript(escrowVersion1, escrowDigest, requestHash, doc.Nonce, ciphertext)
+	attestation, err := s.attestor.Attest(own, transcript[:], doc.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attest escrow share: %w", err)
+	}
+	log.Info("Released escrow share", "signer", e.signerAddress().Hex(), "index", index)
+	return rlp.EncodeToBytes(&escrowShareResponse{
+		Version:     escrowVersion1,
+		Attestation: attestation,
+		Ciphertext:  ciphertext,
+	})
+}
+
+// RecoverSignerKey completes a signer key recovery started with KeyTransferRequest,
+// using the EscrowShare responses of at least threshold custodians. The recovered key
+// is kept as the previous signer key for its overlap period, and new proposals are
+// signed with a fresh key, whose signer attestation (see SignerAttestation) is returned.
+func (s *Server) RecoverSignerKey(ctx context.Context, escrow hexutil.Bytes, responses []hexutil.Bytes) (hexutil.Bytes, error) {
+	e, escrowDigest, err := s.decodeEscrow(escrow)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(responses)) < e.Threshold {
+		return nil, fmt.Errorf("recovery requires %d shares, got %d", e.Threshold, len(responses))
+	}
+
+	type decodedResponse struct {
+		escrowShareResponse
+		nonce     []byte
+		custodian []byte
+		userData  []byte
+	}
+	decoded := make([]*decodedResponse, len(responses))
+	var nonce []byte
+	for i, response := range responses {
+		var res escrowShareResponse
+		if err = rlp.DecodeBytes(response, &res); err != nil {
+			return nil, fmt.Errorf("failed to decode share %d: %w", i, err)
+		}
+		if res.Version != escrowVersion1 {
+			return nil, fmt.Errorf("unsupported escrow share version: %d", res.Version)
+		}
+		verification, err := s.verifier.verify(res.Attestation, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify share %d: %w", i, err)
+		}
+		doc := verification.Document
+		if nonce == nil {
+			nonce = doc.Nonce
+		} else if !bytes.Equal(doc.Nonce, nonce) {
+			return nil, errors.New("escrow shares respond to different requests")
+		}
+		decoded[i] = &decodedResponse{
+			escrowShareResponse: res,
+			nonce:               doc.Nonce,
+			custodian:           doc.PublicKey,
+			userData:            doc.UserData,
+		}
+	}
+
+	// requests are single use, which prevents replaying responses
+	s.keyTransferMutex.Lock()
+	pending, ok := s.keyTransfers[string(nonce)]
+	delete(s.keyTransfers, string(nonce))
+	s.keyTransferMutex.Unlock()
+	if !ok || time.Now().After(pending.expiry) {
+		return nil, errors.New("unknown or expired key transfer request")
+	}
+
+	shares := make([][]byte, 0, len(decoded))
+	custodians := make(map[string]bool, len(decoded))
+	for i, res := range decoded {
+		isCustodian := false
+		for _, share := range e.Shares {
+			isCustodian = isCustodian || bytes.Equal(share.Custodian, res.custodian)
+		}
+		if !isCustodian || custodians[string(res.custodian)] {
+			return nil, fmt.Errorf("share %d is not from a distinct custodian of the escrow", i)
+		}
+		custodians[string(res.custodian)] = true
+		transcript := escrowShareTranscript(res.Version, escrowDigest, pending.request, res.nonce, res.Ciphertext)
+		if !bytes.Equal(res.userData, transcript[:]) {
+			return nil, fmt.Errorf("escrow share %d transcript mismatch", i)
+		}
+		share, err := ecies.ImportECDSA(pending.key).Decrypt(res.Ciphertext, pending.request[:], nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt share %d: %w", i, err)
+		}
+		shares = append(shares, share)
+	}
+	secret, err := shamirCombine(shares)
+	if err != nil {
+		return nil, fmt.Errorf("failed to combine shares: %w", err)
+	}
+	key, err := crypto.ToECDSA(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert key: %w", err)
+	}
+	if !bytes.Equal(crypto.FromECDSAPub(&key.PublicKey), e.Signer) {
+		return nil, errors.New("recovered key does not match the escrowed signer key")
+	}
+	signerKey, err := ecdsa.GenerateKey(crypto.S256(), s.attestor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signer key: %w", err)
+	}
+	attestation, err := s.attestor.Attest(crypto.FromECDSAPub(&signerKey.PublicKey), []byte(signerAttestationTag), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attest signer key: %w", err)
+	}
+	if err = s.signer.replace(signerKey, key, s.signerKeyOverlap); err != nil {
+		return nil, newError(ErrorCodeUnauthorized, "signer_key_overlap", err.Error())
+	}
+	log.Info("Recovered signer key from escrow", "recovered", crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		"address", crypto.PubkeyToAddress(signerKey.PublicKey).Hex(), "shares", len(shares), "overlap", s.signerKeyOverlap)
+	return attestation, nil
+}
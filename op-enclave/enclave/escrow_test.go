@@ -0,0 +1,84 @@
+package enclave
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestEscrowSignerKey(t *testing.T) {
+	ctx := context.Background()
+	owner := newTestServer(t, testPCRs(1))
+	custodians := []*Server{newTestServer(t, testPCRs(1)), newTestServer(t, testPCRs(1)), newTestServer(t, testPCRs(1))}
+	attestations := make([]hexutil.Bytes, len(custodians))
+	for i, custodian := range custodians {
+		var err error
+		if attestations[i], err = custodian.DecryptionAttestation(ctx); err != nil {
+			t.Fatalf("DecryptionAttestation: %v", err)
+		}
+	}
+
+	// other attested keys of a custodian cannot hold shares
+	signerAttestation, err := custodians[0].SignerAttestation(ctx)
+	if err != nil {
+		t.Fatalf("SignerAttestation: %v", err)
+	}
+	if _, err = owner.EscrowSignerKey(ctx, 2, []hexutil.Bytes{signerAttestation, attestations[1]}); err == nil {
+		t.Fatal("signer attestation was accepted as a custodian")
+	}
+
+	escrow, err := owner.EscrowSignerKey(ctx, 2, attestations)
+	if err != nil {
+		t.Fatalf("EscrowSignerKey: %v", err)
+	}
+	recovering := newTestServer(t, testPCRs(1))
+	recovering.signerKeyOverlap = time.Hour
+	request, err := recovering.KeyTransferRequest(ctx, nil)
+	if err != nil {
+		t.Fatalf("KeyTransferRequest: %v", err)
+	}
+	responses := make([]hexutil.Bytes, 2)
+	for i := range responses {
+		if responses[i], err = custodians[i+1].EscrowShare(ctx, escrow, request); err != nil {
+			t.Fatalf("EscrowShare: %v", err)
+		}
+	}
+	attestation, err := recovering.RecoverSignerKey(ctx, escrow, responses)
+	if err != nil {
+		t.Fatalf("RecoverSignerKey: %v", err)
+	}
+
+	// the recovered key is only kept as the previous key, and never signs
+	escrowed := owner.signer.get()
+	if previous, _ := recovering.signer.previousKey(); previous == nil || !previous.Equal(escrowed) {
+		t.Fatal("recovered key is not the previous signer key")
+	}
+	signer := recovering.signer.get()
+	if signer.Equal(escrowed) {
+		t.Fatal("recovered key is used to sign new proposals")
+	}
+	verification, err := recovering.verifier.verify(attestation, []byte(signerAttestationTag), nil)
+	if err != nil {
+		t.Fatalf("failed to verify signer attestation: %v", err)
+	}
+	if !bytes.Equal(verification.Document.PublicKey, crypto.FromECDSAPub(&signer.PublicKey)) {
+		t.Fatal("signer attestation is not for the new signer key")
+	}
+
+	// a journal sealed with the recovered key can be imported
+	journal, err := owner.ExportSigningJournal(ctx)
+	if err != nil {
+		t.Fatalf("ExportSigningJournal: %v", err)
+	}
+	if err = recovering.ImportSigningJournal(ctx, journal); err != nil {
+		t.Fatalf("ImportSigningJournal: %v", err)
+	}
+
+	if _, err = recovering.RecoverSignerKey(ctx, escrow, responses); err == nil {
+		t.Fatal("replayed escrow shares were accepted")
+	}
+}
@@ -0,0 +1,135 @@
+package enclave
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Hardforks contains the activation timestamp of each hardfork after Bedrock, which is
+// always active at genesis. A nil timestamp means the hardfork is not scheduled.
+type Hardforks struct {
+	RegolithTime *uint64 `json:"regolith_time,omitempty"`
+	CanyonTime   *uint64 `json:"canyon_time,omitempty"`
+	DeltaTime    *uint64 `json:"delta_time,omitempty"`
+	EcotoneTime  *uint64 `json:"ecotone_time,omitempty"`
+	FjordTime    *uint64 `json:"fjord_time,omitempty"`
+	GraniteTime  *uint64 `json:"granite_time,omitempty"`
+	HoloceneTime *uint64 `json:"holocene_time,omitempty"`
+	IsthmusTime  *uint64 `json:"isthmus_time,omitempty"`
+}
+
+type hardfork struct {
+	name rollup.ForkName
+	time *uint64
+}
+
+// schedule returns the hardforks in activation order.
+func (h *Hardforks) schedule() []hardfork {
+	return []hardfork{
+		{rollup.Regolith, h.RegolithTime},
+		{rollup.Canyon, h.CanyonTime},
+		{rollup.Delta, h.DeltaTime},
+		{rollup.Ecotone, h.EcotoneTime},
+		{rollup.Fjord, h.FjordTime},
+		{rollup.Granite, h.GraniteTime},
+		{rollup.Holocene, h.HoloceneTime},
+		{rollup.Isthmus, h.IsthmusTime},
+	}
+}
+
+func hardforksFromRollupConfig(cfg *rollup.Config) *Hardforks {
+	return &Hardforks{
+		RegolithTime: cfg.RegolithTime,
+		CanyonTime:   cfg.CanyonTime,
+		DeltaTime:    cfg.DeltaTime,
+		EcotoneTime:  cfg.EcotoneTime,
+		FjordTime:    cfg.FjordTime,
+		GraniteTime:  cfg.GraniteTime,
+		HoloceneTime: cfg.HoloceneTime,
+		IsthmusTime:  cfg.IsthmusTime,
+	}
+}
+
+// defaultHardforks returns the fixed schedule used by version 0 configs.
+func defaultHardforks() *Hardforks {
+	return hardforksFromRollupConfig(&rollupConfigTemplate)
+}
+
+// SupportedHardforks returns the hardforks that can be scheduled in a PerChainConfig.
+func SupportedHardforks() []rollup.ForkName {
+	forks := []rollup.ForkName{rollup.Bedrock}
+	for _, fork := range new(Hardforks).schedule() {
+		forks = append(forks, fork.name)
+	}
+	return forks
+}
+
+// Check returns an error if the hardforks are not scheduled in order.
+func (h *Hardforks) Check() error {
+	var prev hardfork
+	for i, fork := range h.schedule() {
+		if i > 0 && fork.time != nil && (prev.time == nil || *fork.time < *prev.time) {
+			return fmt.Errorf("hardfork %s activates before %s", fork.name, prev.name)
+		}
+		prev = fork
+	}
+	return nil
+}
+
+// Equal returns true if both schedules activate the same hardforks at the same times.
+func (h *Hardforks) Equal(other *Hardforks) bool {
+	a, b := h.schedule(), other.schedule()
+	for i := range a {
+		if (a[i].time == nil) != (b[i].time == nil) {
+			return false
+		}
+		if a[i].time != nil && *a[i].time != *b[i].time {
+			return false
+		}
+	}
+	return true
+}
+
+// appendBinary appends the schedule to data, encoding each hardfork as a presence
+// byte followed by the activation timestamp if present.
+func (h *Hardforks) appendBinary(data []byte) []byte {
+	for _, fork := range h.schedule() {
+		if fork.time == nil {
+			data = append(data, 0)
+			continue
+		}
+		data = append(data, 1)
+		data = binary.BigEndian.AppendUint64(data, *fork.time)
+	}
+	return data
+}
+
+func (h *Hardforks) applyToRollupConfig(cfg *rollup.Config) {
+	cfg.RegolithTime = h.RegolithTime
+	cfg.CanyonTime = h.CanyonTime
+	cfg.DeltaTime = h.DeltaTime
+	cfg.EcotoneTime = h.EcotoneTime
+	cfg.FjordTime = h.FjordTime
+	cfg.GraniteTime = h.GraniteTime
+	cfg.HoloceneTime = h.HoloceneTime
+	cfg.IsthmusTime = h.IsthmusTime
+	cfg.InteropTime = nil
+}
+
+// applyToChainConfig sets the execution layer fork times, following the mapping in
+// op-chain-ops/genesis.
+func (h *Hardforks) applyToChainConfig(cfg *params.ChainConfig) {
+	cfg.RegolithTime = h.RegolithTime
+	cfg.CanyonTime = h.CanyonTime
+	cfg.ShanghaiTime = h.CanyonTime
+	cfg.CancunTime = h.EcotoneTime
+	cfg.EcotoneTime = h.EcotoneTime
+	cfg.FjordTime = h.FjordTime
+	cfg.GraniteTime = h.GraniteTime
+	cfg.HoloceneTime = h.HoloceneTime
+	cfg.IsthmusTime = h.IsthmusTime
+	cfg.InteropTime = nil
+}
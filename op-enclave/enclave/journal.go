@@ -0,0 +1,341 @@
+package enclave
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Signing journal
+//
+// Similar to validator slashing protection, the enclave records the output root it
+// signs for each L2 block number per config hash, and refuses to sign a different
+// output root for the same block, including as part of an aggregate. Only the most
+// recent JournalSize entries are kept per config hash; blocks below the pruned range
+// cannot be signed, as a conflict could not be detected.
+//
+// The journal is not persisted, but can be exported sealed with a key derived from the
+// signer key, and imported by any enclave holding the same signer key. It is also sent
+// along with the signer key during key transfer.
+const (
+	defaultJournalSize        = 1 << 18
+	journalVersion1    uint64 = 1
+	journalSealTag            = "op-enclave/journal/seal"
+)
+
+// JournalSizeFromEnv reads the number of journal entries to keep per config hash
+// from the OP_ENCLAVE_JOURNAL_SIZE env var.
+func JournalSizeFromEnv() (int, error) {
+	size := os.Getenv("OP_ENCLAVE_JOURNAL_SIZE")
+	if size == "" {
+		return defaultJournalSize, nil
+	}
+	n, err := strconv.ParseUint(size, 10, 32)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid OP_ENCLAVE_JOURNAL_SIZE: %s", size)
+	}
+	return int(n), nil
+}
+
+// JournalSummary describes the signing journal for a single config hash.
+type JournalSummary struct {
+	ConfigHash        common.Hash    `json:"config_hash"`
+	LatestBlockNumber hexutil.Uint64 `json:"latest_block_number"`
+	LatestOutputRoot  common.Hash    `json:"latest_output_root"`
+	Entries           hexutil.Uint64 `json:"entries"`
+	// PrunedBelow is the lowest block number that can still be signed.
+	PrunedBelow hexutil.Uint64 `json:"pruned_below"`
+}
+
+type journalExport struct {
+	Version uint64
+	Chains  []*journalExportChain
+}
+
+type journalExportChain struct {
+	ConfigHash  common.Hash
+	PrunedBelow uint64
+	Numbers     []uint64
+	Roots       []common.Hash
+}
+
+type signingJournal struct {
+	size   int
+	mutex  sync.Mutex
+	chains map[common.Hash]*journalChain
+}
+
+type journalChain struct {
+	// numbers is sorted ascending
+	numbers     []uint64
+	roots       map[uint64]common.Hash
+	prunedBelow uint64
+}
+
+func newSigningJournal(size int) *signingJournal {
+	if size <= 0 {
+		size = defaultJournalSize
+	}
+	return &signingJournal{
+		size:   size,
+		chains: make(map[common.Hash]*journalChain),
+	}
+}
+
+func (c *journalChain) check(number uint64, outputRoot common.Hash) error {
+	if signed, ok := c.roots[number]; ok {
+		if signed != outputRoot {
+			return newMismatchError(ErrorCodeEquivocation, "signing_journal",
+				fmt.Sprintf("already signed a different output root for block %d", number), signed, outputRoot)
+		}
+		return nil
+	}
+	if number < c.prunedBelow {
+		return newError(ErrorCodeEquivocation, "signing_journal",
+			fmt.Sprintf("block %d is below the signing journal's range (%d)", number, c.prunedBelow))
+	}
+	return nil
+}
+
+func (c *journalChain) add(number uint64, outputRoot common.Hash, size int) {
+	if _, ok := c.roots[number]; ok {
+		return
+	}
+	c.roots[number] = outputRoot
+	i, _ := slices.BinarySearch(c.numbers, number)
+	c.numbers = slices.Insert(c.numbers, i, number)
+	for len(c.numbers) > size {
+		oldest := c.numbers[0]
+		c.numbers = c.numbers[1:]
+		delete(c.roots, oldest)
+		c.prunedBelow = max(c.prunedBelow, oldest+1)
+	}
+}
+
+// check returns an error if signing outputRoot for the block would conflict with the journal.
+func (j *signingJournal) check(configHash common.Hash, number uint64, outputRoot common.Hash) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	chain, ok := j.chains[configHash]
+	if !ok {
+		return nil
+	}
+	return chain.check(number, outputRoot)
+}
+
+// record checks and records outputRoot for the block, which must be done before signing.
+func (j *signingJournal) record(configHash common.Hash, number uint64, outputRoot common.Hash) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	chain, ok := j.chains[configHash]
+	if !ok {
+		chain = &journalChain{roots: make(map[uint64]common.Hash)}
+		j.chains[configHash] = chain
+	}
+	if err := chain.check(number, outputRoot); err != nil {
+		return err
+	}
+	chain.add(number, outputRoot, j.size)
+	return nil
+}
+
+func (j *signingJournal) lookup(configHash common.Hash, number uint64) *common.Hash {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	chain, ok := j.chains[configHash]
+	if !ok {
+		return nil
+	}
+	root, ok := chain.roots[number]
+	if !ok {
+		return nil
+	}
+	return &root
+}
+
+func (j *signingJournal) summaries() []*JournalSummary {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	summaries := make([]*JournalSummary, 0, len(j.chains))
+	for configHash, chain := range j.chains {
+		summary := &JournalSummary{
+			ConfigHash:  configHash,
+			Entries:     hexutil.Uint64(len(chain.numbers)),
+			PrunedBelow: hexutil.Uint64(chain.prunedBelow),
+		}
+		if len(chain.numbers) > 0 {
+			latest := chain.numbers[len(chain.numbers)-1]
+			summary.LatestBlockNumber = hexutil.Uint64(latest)
+			summary.LatestOutputRoot = chain.roots[latest]
+		}
+		summaries = append(summaries, summary)
+	}
+	slices.SortFunc(summaries, func(x, y *JournalSummary) int {
+		return x.ConfigHash.Cmp(y.ConfigHash)
+	})
+	return summaries
+}
+
+func (j *signingJournal) export() *journalExport {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	export := &journalExport{
+		Version: journalVersion1,
+		Chains:  make([]*journalExportChain, 0, len(j.chains)),
+	}
+	for configHash, chain := range j.chains {
+		c := &journalExportChain{
+			ConfigHash:  configHash,
+			PrunedBelow: chain.prunedBelow,
+			Numbers:     slices.Clone(chain.numbers),
+			Roots:       make([]common.Hash, len(chain.numbers)),
+		}
+		for i, number := range chain.numbers {
+			c.Roots[i] = chain.roots[number]
+		}
+		export.Chains = append(export.Chains, c)
+	}
+	return export
+}
+
+// merge adds the entries of an exported journal. Nothing is merged if any entry
+// conflicts with this journal.
+func (j *signingJournal) merge(export *journalExport) error {
+	if export.Version != journalVersion1 {
+		return fmt.Errorf("unsupported journal version: %d", export.Version)
+	}
+	for _, c := range export.Chains {
+		if len(c.Numbers) != len(c.Roots) {
+			return errors.New("invalid journal")
+		}
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	for _, c := range export.Chains {
+		chain, ok := j.chains[c.ConfigHash]
+		if !ok {
+			continue
+		}
+		for i, number := range c.Numbers {
+			if signed, ok := chain.roots[number]; ok && signed != c.Roots[i] {
+				return newMismatchError(ErrorCodeEquivocation, "signing_journal",
+					fmt.Sprintf("imported journal conflicts at block %d", number), signed, c.Roots[i])
+			}
+		}
+	}
+	for _, c := range export.Chains {
+		chain, ok := j.chains[c.ConfigHash]
+		if !ok {
+			chain = &journalChain{roots: make(map[uint64]common.Hash)}
+			j.chains[c.ConfigHash] = chain
+		}
+		chain.prunedBelow = max(chain.prunedBelow, c.PrunedBelow)
+		for i, number := range c.Numbers {
+			if number >= chain.prunedBelow {
+				chain.add(number, c.Roots[i], j.size)
+			}
+		}
+	}
+	return nil
+}
+
+func journalSealKey(signerKey *ecdsa.PrivateKey) []byte {
+	return crypto.Keccak256([]byte(journalSealTag), crypto.FromECDSA(signerKey))
+}
+
+// sealJournal encrypts the journal with AES-GCM, using a key derived from the signer key.
+func sealJournal(export *journalExport, signerKey *ecdsa.PrivateKey, rand io.Reader) ([]byte, error) {
+	plaintext, err := rlp.EncodeToBytes(export)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode journal: %w", err)
+	}
+	block, err := aes.NewCipher(journalSealKey(signerKey))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, []byte(journalSealTag)), nil
+}
+
+func unsealJournal(sealed []byte, signerKey *ecdsa.PrivateKey) (*journalExport, error) {
+	block, err := aes.NewCipher(journalSealKey(signerKey))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed journal too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(journalSealTag))
+	if err != nil {
+		return nil, errors.New("failed to unseal journal, it may have been sealed with a different signer key")
+	}
+	var export journalExport
+	if err = rlp.DecodeBytes(plaintext, &export); err != nil {
+		return nil, fmt.Errorf("failed to decode journal: %w", err)
+	}
+	return &export, nil
+}
+
+// SigningJournal returns a summary of the signing journal for each config hash.
+func (s *Server) SigningJournal(ctx context.Context) ([]*JournalSummary, error) {
+	return s.journal.summaries(), nil
+}
+
+// SignedOutputRoot returns the output root signed for the L2 block, or nil if there
+// is no journal entry for it.
+func (s *Server) SignedOutputRoot(ctx context.Context, configHash common.Hash, number hexutil.Uint64) (*common.Hash, error) {
+	return s.journal.lookup(configHash, uint64(number)), nil
+}
+
+// ExportSigningJournal returns the signing journal, sealed with a key derived from the
+// signer key.
+func (s *Server) ExportSigningJournal(ctx context.Context) (hexutil.Bytes, error) {
+	return sealJournal(s.journal.export(), s.signer.get(), s.attestor)
+}
+
+// ImportSigningJournal merges a journal exported by an enclave with the same signer key,
+// or with the previous signer key during its overlap period.
+func (s *Server) ImportSigningJournal(ctx context.Context, sealed hexutil.Bytes) error {
+	var export *journalExport
+	var err error
+	for _, key := range s.signer.active() {
+		if export, err = unsealJournal(sealed, key); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err = s.journal.merge(export); err != nil {
+		return err
+	}
+	log.Info("Imported signing journal", "configs", len(export.Chains))
+	return nil
+}
@@ -0,0 +1,275 @@
+package enclave
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Signer key transfer protocol
+//
+// The receiving enclave calls KeyTransferRequest, which generates an ephemeral key and
+// a nonce, and returns an attestation over both. The sending enclave verifies this in
+// EncryptedSignerKey, ECIES-encrypts its signer key to the ephemeral key, and returns
+// the ciphertext alongside its own attestation, which echoes the nonce and commits to
+// the transcript hash of the exchange. The receiver verifies the sender's attestation,
+// the nonce and the transcript hash in SetSignerKey before accepting the key. Each
+// request can only be used once, and expires after keyTransferTimeout.
+//
+// In version 1 the ciphertext is the raw signer key. Since version 2, it is an RLP
+// encoded keyTransferPayload that also contains the sender's signing journal, which the
+// receiver merges into its own. The version is part of the request attestation's user
+// data, and the sender replies in the version of the request, so images that only
+// support version 1 can still exchange keys with newer images: a newer receiver requests
+// version 1 from an older sender, and a newer sender answers an older receiver's
+// version 1 request, but only while its journal is empty. The host chooses the version,
+// so a sender that has signed would otherwise hand its key to a receiver without the
+// journal, which could then sign a conflicting output root for a signed block.
+//
+// # Migrating from the RSA key transfer
+//
+// Images before version 1 transferred the raw signer key, RSA encrypted to the
+// DecryptionAttestation of the receiver, and only to receivers with the sender's own
+// PCR0. They can never hand their key to an image with a different PCR0, so upgrading
+// from them is a one-time migration instead of a key transfer: the new image generates
+// its own signer key, which is registered alongside the old one (see register-signer),
+// the proposer is switched to the new image, and the old signer is deregistered once
+// the new image's first proposal has been accepted. SetSignerKey rejects RSA
+// ciphertexts with an error pointing to this migration.
+const (
+	keyTransferVersion1      uint64 = 1
+	keyTransferVersion2      uint64 = 2
+	keyTransferNonceSize            = 32
+	keyTransferTimeout              = 10 * time.Minute
+	maxPendingKeyTransfers          = 16
+	keyTransferRequestTag           = "op-enclave/key-transfer/request"
+	keyTransferTranscriptTag        = "op-enclave/key-transfer/transcript"
+
+	// legacyKeyTransferCiphertextSize is the size of an RSA-4096 ciphertext sent by
+	// images before version 1.
+	legacyKeyTransferCiphertextSize = 512
+)
+
+var errLegacyKeyTransfer = errors.New("RSA key transfers from images before key transfer version 1 are not supported, " +
+	"migrate by registering this enclave's signer key instead")
+
+type keyTransferResponse struct {
+	Version     uint64
+	Attestation []byte
+	Ciphertext  []byte
+}
+
+type keyTransferPayload struct {
+	Key     []byte
+	Journal *journalExport
+}
+
+type pendingKeyTransfer struct {
+	version uint64
+	request common.Hash
+	key     *ecdsa.PrivateKey
+	expiry  time.Time
+}
+
+func keyTransferRequestUserData(version uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte(keyTransferRequestTag), version)
+}
+
+// keyTransferRequestVersion returns the version of a key transfer request from its
+// attestation's user data.
+func keyTransferRequestVersion(userData []byte) (uint64, error) {
+	for _, version := range []uint64{keyTransferVersion1, keyTransferVersion2} {
+		if bytes.Equal(userData, keyTransferRequestUserData(version)) {
+			return version, nil
+		}
+	}
+	return 0, errors.New("attestation is not a supported key transfer request")
+}
+
+func keyTransferTranscript(version uint64, request common.Hash, nonce []byte, signerPublicKey []byte, ciphertext []byte) common.Hash {
+	data := binary.BigEndian.AppendUint64([]byte(keyTransferTranscriptTag), version)
+	data = append(data, request[:]...)
+	data = append(data, crypto.Keccak256(nonce)...)
+	data = append(data, crypto.Keccak256(signerPublicKey)...)
+	data = append(data, crypto.Keccak256(ciphertext)...)
+	return crypto.Keccak256Hash(data)
+}
+
+// KeyTransferRequest starts a signer key transfer into this enclave. The returned
+// attestation should be passed to EncryptedSignerKey on the enclave holding the key.
+// The version defaults to the latest, and should only be set to 1 to receive the key
+// from an image that does not support version 2.
+func (s *Server) KeyTransferRequest(ctx context.Context, version *hexutil.Uint64) (hexutil.Bytes, error) {
+	requestVersion := keyTransferVersion2
+	if version != nil {
+		requestVersion = uint64(*version)
+	}
+	if requestVersion != keyTransferVersion1 && requestVersion != keyTransferVersion2 {
+		return nil, fmt.Errorf("unsupported key transfer version: %d", requestVersion)
+	}
+	nonce := make([]byte, keyTransferNonceSize)
+	if _, err := io.ReadFull(s.attestor, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	key, err := ecdsa.GenerateKey(crypto.S256(), s.attestor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	request, err := s.attestor.Attest(crypto.FromECDSAPub(&key.PublicKey), keyTransferRequestUserData(requestVersion), nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attest key transfer request: %w", err)
+	}
+
+	s.keyTransferMutex.Lock()
+	defer s.keyTransferMutex.Unlock()
+	now := time.Now()
+	for n, p := range s.keyTransfers {
+		if now.After(p.expiry) {
+			delete(s.keyTransfers, n)
+		}
+	}
+	if len(s.keyTransfers) >= maxPendingKeyTransfers {
+		return nil, errors.New("too many pending key transfer requests")
+	}
+	s.keyTransfers[string(nonce)] = &pendingKeyTransfer{
+		version: requestVersion,
+		request: crypto.Keccak256Hash(request),
+		key:     key,
+		expiry:  now.Add(keyTransferTimeout),
+	}
+	return request, nil
+}
+
+// EncryptedSignerKey encrypts this enclave's signer key, and for version 2 requests its
+// signing journal, for the enclave that produced the given KeyTransferRequest attestation.
+// The response has the version of the request. Version 1 requests are refused once
+// this enclave has signed, as they cannot carry the journal.
+func (s *Server) EncryptedSignerKey(ctx context.Context, request hexutil.Bytes) (hexutil.Bytes, error) {
+	verification, err := s.verifier.verify(request, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify key transfer request: %w", err)
+	}
+	doc := verification.Document
+	version, err := keyTransferRequestVersion(doc.UserData)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Nonce) != keyTransferNonceSize {
+		return nil, errors.New("key transfer request has an invalid nonce")
+	}
+	public, err := crypto.UnmarshalPubkey(doc.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	// only the current signer key is transferred, not a previous key in its overlap period
+	signerKey := s.signer.get()
+	payload := crypto.FromECDSA(signerKey)
+	journal := s.journal.export()
+	if version == keyTransferVersion2 {
+		payload, err = rlp.EncodeToBytes(&keyTransferPayload{
+			Key:     payload,
+			Journal: journal,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode key transfer payload: %w", err)
+		}
+	} else if len(journal.Chains) > 0 {
+		return nil, newError(ErrorCodeUnauthorized, "key_transfer_version",
+			"version 1 key transfer requests cannot carry the signing journal, and are refused once the signer key has signed")
+	} else {
+		log.Warn("Sending signer key to a version 1 key transfer request")
+	}
+	requestHash := crypto.Keccak256Hash(request)
+	ciphertext, err := ecies.Encrypt(s.attestor, ecies.ImportECDSAPublic(public), payload, requestHash[:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt key: %w", err)
+	}
+	signerPublicKey := crypto.FromECDSAPub(&signerKey.PublicKey)
+	transcript := keyTransferTranscript(version, requestHash, doc.Nonce, signerPublicKey, ciphertext)
+	attestation, err := s.attestor.Attest(signerPublicKey, transcript[:], doc.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attest key transfer response: %w", err)
+	}
+	return rlp.EncodeToBytes(&keyTransferResponse{
+		Version:     version,
+		Attestation: attestation,
+		Ciphertext:  ciphertext,
+	})
+}
+
+// SetSignerKey completes a signer key transfer started with KeyTransferRequest,
+// using the response returned from EncryptedSignerKey. It fails while a previous signer
+// key is in its overlap period, so that a transfer cannot drop it (see RotateSignerKey).
+func (s *Server) SetSignerKey(ctx context.Context, response hexutil.Bytes) error {
+	var res keyTransferResponse
+	if err := rlp.DecodeBytes(response, &res); err != nil {
+		if len(response) == legacyKeyTransferCiphertextSize {
+			return errLegacyKeyTransfer
+		}
+		return fmt.Errorf("failed to decode key transfer response: %w", err)
+	}
+	verification, err := s.verifier.verify(res.Attestation, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to verify key transfer response: %w", err)
+	}
+	doc := verification.Document
+
+	// requests are single use, which prevents replaying a response
+	s.keyTransferMutex.Lock()
+	pending, ok := s.keyTransfers[string(doc.Nonce)]
+	delete(s.keyTransfers, string(doc.Nonce))
+	s.keyTransferMutex.Unlock()
+	if !ok || time.Now().After(pending.expiry) {
+		return errors.New("unknown or expired key transfer request")
+	}
+	if res.Version != pending.version {
+		return fmt.Errorf("key transfer response version %d does not match request version %d", res.Version, pending.version)
+	}
+
+	transcript := keyTransferTranscript(res.Version, pending.request, doc.Nonce, doc.PublicKey, res.Ciphertext)
+	if !bytes.Equal(doc.UserData, transcript[:]) {
+		return errors.New("key transfer transcript mismatch")
+	}
+	decrypted, err := ecies.ImportECDSA(pending.key).Decrypt(res.Ciphertext, pending.request[:], nil)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt key: %w", err)
+	}
+	payload := keyTransferPayload{Key: decrypted}
+	if res.Version == keyTransferVersion2 {
+		if err = rlp.DecodeBytes(decrypted, &payload); err != nil {
+			return fmt.Errorf("failed to decode key transfer payload: %w", err)
+		}
+	}
+	key, err := crypto.ToECDSA(payload.Key)
+	if err != nil {
+		return fmt.Errorf("failed to convert key: %w", err)
+	}
+	if !bytes.Equal(crypto.FromECDSAPub(&key.PublicKey), doc.PublicKey) {
+		return errors.New("decrypted key does not match attested public key")
+	}
+	// the journal must be merged before the key can be used to sign; version 1 senders
+	// predate the journal, so have no signatures to merge
+	if payload.Journal != nil {
+		if err = s.journal.merge(payload.Journal); err != nil {
+			return fmt.Errorf("failed to merge signing journal: %w", err)
+		}
+	}
+	if err = s.signer.set(key); err != nil {
+		return newError(ErrorCodeUnauthorized, "signer_key_overlap", err.Error())
+	}
+	log.Info("Received signer key", "address", crypto.PubkeyToAddress(key.PublicKey).Hex())
+	return nil
+}
@@ -0,0 +1,145 @@
+package enclave
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func newTestServer(t *testing.T, pcrs map[uint][]byte) *Server {
+	t.Helper()
+	attestor, err := NewEmulatedAttestor(pcrs)
+	if err != nil {
+		t.Fatalf("failed to create attestor: %v", err)
+	}
+	s, err := NewServer(ServerConfig{
+		Attestor:          attestor,
+		AttestationPolicy: DefaultAttestationPolicy(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	return s
+}
+
+func testPCRs(pcr0 byte) map[uint][]byte {
+	return map[uint][]byte{0: bytes.Repeat([]byte{pcr0}, emulatorPCRLength)}
+}
+
+func TestKeyTransfer(t *testing.T) {
+	for _, version := range []uint64{keyTransferVersion1, keyTransferVersion2} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			ctx := context.Background()
+			sender := newTestServer(t, testPCRs(1))
+			receiver := newTestServer(t, testPCRs(1))
+
+			request, err := receiver.KeyTransferRequest(ctx, (*hexutil.Uint64)(&version))
+			if err != nil {
+				t.Fatalf("KeyTransferRequest: %v", err)
+			}
+			response, err := sender.EncryptedSignerKey(ctx, request)
+			if err != nil {
+				t.Fatalf("EncryptedSignerKey: %v", err)
+			}
+			var res keyTransferResponse
+			if err = rlp.DecodeBytes(response, &res); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if res.Version != version {
+				t.Fatalf("response version %d does not match request version %d", res.Version, version)
+			}
+			if err = receiver.SetSignerKey(ctx, response); err != nil {
+				t.Fatalf("SetSignerKey: %v", err)
+			}
+
+			expected, _ := sender.SignerPublicKey(ctx)
+			actual, _ := receiver.SignerPublicKey(ctx)
+			if !bytes.Equal(expected, actual) {
+				t.Fatalf("signer key was not transferred: %x != %x", actual, expected)
+			}
+			if err = receiver.SetSignerKey(ctx, response); err == nil {
+				t.Fatal("replayed key transfer response was accepted")
+			}
+		})
+	}
+}
+
+func TestKeyTransferVersionMismatch(t *testing.T) {
+	ctx := context.Background()
+	sender := newTestServer(t, testPCRs(1))
+	receiver := newTestServer(t, testPCRs(1))
+
+	request, err := receiver.KeyTransferRequest(ctx, nil)
+	if err != nil {
+		t.Fatalf("KeyTransferRequest: %v", err)
+	}
+	response, err := sender.EncryptedSignerKey(ctx, request)
+	if err != nil {
+		t.Fatalf("EncryptedSignerKey: %v", err)
+	}
+	var res keyTransferResponse
+	if err = rlp.DecodeBytes(response, &res); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	// a downgraded response fails the version check before the transcript check
+	res.Version = keyTransferVersion1
+	if response, err = rlp.EncodeToBytes(&res); err != nil {
+		t.Fatal(err)
+	}
+	if err = receiver.SetSignerKey(ctx, response); err == nil {
+		t.Fatal("key transfer response with a different version was accepted")
+	}
+}
+
+func TestKeyTransferVersion1WithJournal(t *testing.T) {
+	ctx := context.Background()
+	sender := newTestServer(t, testPCRs(1))
+	receiver := newTestServer(t, testPCRs(1))
+	if err := sender.journal.record(common.Hash{1}, 10, common.Hash{2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a version 1 receiver would get the key without the journal
+	version := hexutil.Uint64(keyTransferVersion1)
+	request, err := receiver.KeyTransferRequest(ctx, &version)
+	if err != nil {
+		t.Fatalf("KeyTransferRequest: %v", err)
+	}
+	if _, err = sender.EncryptedSignerKey(ctx, request); err == nil {
+		t.Fatal("version 1 key transfer request was answered by a sender with journal entries")
+	}
+
+	request, err = receiver.KeyTransferRequest(ctx, nil)
+	if err != nil {
+		t.Fatalf("KeyTransferRequest: %v", err)
+	}
+	response, err := sender.EncryptedSignerKey(ctx, request)
+	if err != nil {
+		t.Fatalf("EncryptedSignerKey: %v", err)
+	}
+	if err = receiver.SetSignerKey(ctx, response); err != nil {
+		t.Fatalf("SetSignerKey: %v", err)
+	}
+	if root := receiver.journal.lookup(common.Hash{1}, 10); root == nil || *root != (common.Hash{2}) {
+		t.Fatal("signing journal was not transferred")
+	}
+}
+
+func TestKeyTransferPCR0Mismatch(t *testing.T) {
+	ctx := context.Background()
+	sender := newTestServer(t, testPCRs(1))
+	receiver := newTestServer(t, testPCRs(2))
+
+	request, err := receiver.KeyTransferRequest(ctx, nil)
+	if err != nil {
+		t.Fatalf("KeyTransferRequest: %v", err)
+	}
+	if _, err = sender.EncryptedSignerKey(ctx, request); err == nil {
+		t.Fatal("key transfer request from a different PCR0 was accepted")
+	}
+}
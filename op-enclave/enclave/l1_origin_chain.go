@@ -0,0 +1,77 @@
+package enclave
+
+import (
+	"fmt"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// MaxL1OriginChainLength is the maximum number of L1 blocks between the L1 origin of a
+// block's parent and its own L1 origin.
+const MaxL1OriginChainLength = 32
+
+// L1Block is an L1 header with its receipts.
+type L1Block struct {
+	Header   *types.Header  `json:"header"`
+	Receipts types.Receipts `json:"receipts"`
+}
+
+// applyL1OriginChain verifies that chain links the L1 origin of l2Parent to l1Origin,
+// oldest block first, and applies the system config updates of the skipped L1 blocks to
+// sysConfig. The returned block ref has the last block of the chain as its L1 origin, so
+// that l1Origin is derived as the next epoch.
+//
+// Deposits are only derived from the L1 origin of a block, so skipping an L1 block with
+// deposits would drop them, and is rejected.
+func applyL1OriginChain(
+	rollupConfig *rollup.Config,
+	l2Parent eth.L2BlockRef,
+	sysConfig eth.SystemConfig,
+	l1Origin *types.Header,
+	chain []*L1Block,
+) (eth.L2BlockRef, eth.SystemConfig, error) {
+	if len(chain) > MaxL1OriginChainLength {
+		return eth.L2BlockRef{}, eth.SystemConfig{}, newError(ErrorCodeInvalidRequest, "l1_origin_chain",
+			fmt.Sprintf("L1 origin chain has %d blocks, limit is %d", len(chain), MaxL1OriginChainLength))
+	}
+	parent := l2Parent.L1Origin
+	for _, block := range chain {
+		if block == nil || block.Header == nil || block.Header.Number == nil {
+			return eth.L2BlockRef{}, eth.SystemConfig{}, newError(ErrorCodeInvalidRequest, "l1_origin_chain", "missing L1 header")
+		}
+		header := block.Header
+		if header.ParentHash != parent.Hash {
+			return eth.L2BlockRef{}, eth.SystemConfig{}, newMismatchError(ErrorCodeInputMismatch, "l1_origin_chain",
+				fmt.Sprintf("L1 block %s is not a child of L1 block %d", header.Number, parent.Number), parent.Hash, header.ParentHash)
+		}
+		computed := types.DeriveSha(block.Receipts, trie.NewStackTrie(nil))
+		if computed != header.ReceiptHash {
+			return eth.L2BlockRef{}, eth.SystemConfig{}, newMismatchError(ErrorCodeInputMismatch, "l1_origin_chain_receipts",
+				fmt.Sprintf("invalid receipts for L1 block %s", header.Number), header.ReceiptHash, computed)
+		}
+		deposits, err := derive.UserDeposits(block.Receipts, rollupConfig.DepositContractAddress)
+		if err != nil {
+			return eth.L2BlockRef{}, eth.SystemConfig{}, wrapError(ErrorCodeInvalidBlock, "l1_origin_chain_deposits",
+				fmt.Sprintf("failed to read deposits of skipped L1 block %s", header.Number), err)
+		}
+		if len(deposits) > 0 {
+			return eth.L2BlockRef{}, eth.SystemConfig{}, newError(ErrorCodeInvalidBlock, "l1_origin_chain_deposits",
+				fmt.Sprintf("skipped L1 block %s contains deposits", header.Number))
+		}
+		if err = derive.UpdateSystemConfigWithL1Receipts(&sysConfig, block.Receipts, rollupConfig, header.Time); err != nil {
+			return eth.L2BlockRef{}, eth.SystemConfig{}, wrapError(ErrorCodeInputMismatch, "l1_origin_chain_system_config",
+				fmt.Sprintf("failed to apply system config updates of L1 block %s", header.Number), err)
+		}
+		parent = eth.BlockID{Hash: header.Hash(), Number: header.Number.Uint64()}
+	}
+	if l1Origin.ParentHash != parent.Hash {
+		return eth.L2BlockRef{}, eth.SystemConfig{}, newMismatchError(ErrorCodeInputMismatch, "l1_origin_chain",
+			fmt.Sprintf("L1 origin %s is not a child of L1 block %d", l1Origin.Number, parent.Number), parent.Hash, l1Origin.ParentHash)
+	}
+	l2Parent.L1Origin = parent
+	return l2Parent, sysConfig, nil
+}
@@ -0,0 +1,187 @@
+package enclave
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	testDepositContract = common.Address{0xd0}
+	testSystemConfig    = common.Address{0x5c}
+)
+
+func testL1OriginChainConfig() *PerChainConfig {
+	return &PerChainConfig{
+		ChainID:                big.NewInt(1),
+		BlockTime:              2,
+		MaxSequencerDrift:      600,
+		SeqWindowSize:          3600,
+		ChannelTimeoutBedrock:  300,
+		DepositContractAddress: testDepositContract,
+		L1SystemConfigAddress:  testSystemConfig,
+		Hardforks:              activeHardforks(6),
+	}
+}
+
+// testL1Chain returns an L1 block followed by n blocks with the given receipts, and
+// the L1 origin that follows them.
+func testL1Chain(n int, receipts func(i int) types.Receipts) (*types.Header, []*L1Block, *types.Header) {
+	first := &types.Header{Number: big.NewInt(100), Time: 1_000_000}
+	parent := first
+	chain := make([]*L1Block, n)
+	for i := range chain {
+		r := receipts(i)
+		header := &types.Header{
+			ParentHash:  parent.Hash(),
+			Number:      new(big.Int).Add(parent.Number, common.Big1),
+			Time:        parent.Time + 12,
+			ReceiptHash: types.DeriveSha(r, trie.NewStackTrie(nil)),
+		}
+		chain[i] = &L1Block{Header: header, Receipts: r}
+		parent = header
+	}
+	l1Origin := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		Time:       parent.Time + 12,
+	}
+	return first, chain, l1Origin
+}
+
+func testReceipt(logs ...*types.Log) *types.Receipt {
+	return &types.Receipt{Status: types.ReceiptStatusSuccessful, Logs: logs}
+}
+
+func testGasLimitUpdate(gasLimit uint64) *types.Log {
+	data := make([]byte, 96)
+	binary.BigEndian.PutUint64(data[24:32], 32)
+	binary.BigEndian.PutUint64(data[56:64], 32)
+	binary.BigEndian.PutUint64(data[88:96], gasLimit)
+	return &types.Log{
+		Address: testSystemConfig,
+		Topics:  []common.Hash{derive.ConfigUpdateEventABIHash, derive.ConfigUpdateEventVersion0, derive.SystemConfigUpdateGasLimit},
+		Data:    data,
+	}
+}
+
+func TestApplyL1OriginChain(t *testing.T) {
+	rollupConfig := testL1OriginChainConfig().ToRollupConfig()
+	sysConfig := eth.SystemConfig{GasLimit: 30_000_000}
+	deposit, err := derive.MarshalDepositLogEvent(testDepositContract, &types.DepositTx{
+		From:  common.Address{0x01},
+		To:    &common.Address{0x02},
+		Mint:  big.NewInt(1),
+		Value: big.NewInt(1),
+		Gas:   21_000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	malformedDeposit := &types.Log{
+		Address: testDepositContract,
+		Topics:  []common.Hash{derive.DepositEventABIHash},
+	}
+	noReceipts := func(int) types.Receipts { return nil }
+
+	applyChain := func(first *types.Header, chain []*L1Block, l1Origin *types.Header) (eth.L2BlockRef, eth.SystemConfig, error) {
+		l2Parent := eth.L2BlockRef{L1Origin: eth.BlockID{Hash: first.Hash(), Number: first.Number.Uint64()}}
+		return applyL1OriginChain(rollupConfig, l2Parent, sysConfig, l1Origin, chain)
+	}
+	requireCheck := func(t *testing.T, err error, check string) *Error {
+		t.Helper()
+		var enclaveErr *Error
+		if !errors.As(err, &enclaveErr) || enclaveErr.Check != check {
+			t.Fatalf("expected %s error, got: %v", check, err)
+		}
+		return enclaveErr
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		first, chain, l1Origin := testL1Chain(3, noReceipts)
+		l2Parent, updated, err := applyChain(first, chain, l1Origin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last := chain[len(chain)-1].Header
+		if l2Parent.L1Origin != (eth.BlockID{Hash: last.Hash(), Number: last.Number.Uint64()}) {
+			t.Fatalf("L1 origin is not the last skipped block: %v", l2Parent.L1Origin)
+		}
+		if updated != sysConfig {
+			t.Fatalf("system config changed without updates: %v", updated)
+		}
+	})
+
+	t.Run("system config update", func(t *testing.T) {
+		first, chain, l1Origin := testL1Chain(3, func(i int) types.Receipts {
+			if i == 1 {
+				return types.Receipts{testReceipt(testGasLimitUpdate(60_000_000))}
+			}
+			return nil
+		})
+		_, updated, err := applyChain(first, chain, l1Origin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.GasLimit != 60_000_000 {
+			t.Fatalf("system config update in the skipped blocks was not applied: %d", updated.GasLimit)
+		}
+	})
+
+	t.Run("broken hash link", func(t *testing.T) {
+		first, chain, l1Origin := testL1Chain(3, noReceipts)
+		chain[1].Header.ParentHash = common.Hash{0x01}
+		_, _, err := applyChain(first, chain, l1Origin)
+		requireCheck(t, err, "l1_origin_chain")
+	})
+
+	t.Run("L1 origin not linked", func(t *testing.T) {
+		first, chain, l1Origin := testL1Chain(3, noReceipts)
+		_, _, err := applyChain(first, chain[:2], l1Origin)
+		requireCheck(t, err, "l1_origin_chain")
+	})
+
+	t.Run("receipts root mismatch", func(t *testing.T) {
+		first, chain, l1Origin := testL1Chain(3, noReceipts)
+		// omitting a receipt, e.g. one with a deposit, changes the receipts root
+		chain[0].Receipts = types.Receipts{testReceipt(deposit)}
+		_, _, err := applyChain(first, chain, l1Origin)
+		requireCheck(t, err, "l1_origin_chain_receipts")
+	})
+
+	t.Run("skipped block with deposits", func(t *testing.T) {
+		first, chain, l1Origin := testL1Chain(3, func(i int) types.Receipts {
+			if i == 2 {
+				return types.Receipts{testReceipt(deposit)}
+			}
+			return nil
+		})
+		_, _, err := applyChain(first, chain, l1Origin)
+		if requireCheck(t, err, "l1_origin_chain_deposits").Err != nil {
+			t.Fatalf("deposits were reported as a decoding error: %v", err)
+		}
+	})
+
+	t.Run("skipped block with malformed deposit", func(t *testing.T) {
+		first, chain, l1Origin := testL1Chain(1, func(int) types.Receipts {
+			return types.Receipts{testReceipt(malformedDeposit)}
+		})
+		_, _, err := applyChain(first, chain, l1Origin)
+		if requireCheck(t, err, "l1_origin_chain_deposits").Err == nil {
+			t.Fatalf("malformed deposit was reported without the decoding error: %v", err)
+		}
+	})
+
+	t.Run("too long", func(t *testing.T) {
+		first, chain, l1Origin := testL1Chain(MaxL1OriginChainLength+1, noReceipts)
+		_, _, err := applyChain(first, chain, l1Origin)
+		requireCheck(t, err, "l1_origin_chain")
+	})
+}
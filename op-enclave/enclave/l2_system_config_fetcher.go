@@ -36,6 +36,27 @@ func (l *l2SystemConfigFetcher) SystemConfigByL2Hash(ctx context.Context, hash c
 	return blockToSystemConfig(l.config, l.header, l.txs)
 }
 
+// staticSystemConfigFetcher returns a system config that was already derived, e.g. with
+// updates applied from L1 blocks skipped by the L1 origin.
+type staticSystemConfigFetcher struct {
+	hash   common.Hash
+	config eth.SystemConfig
+}
+
+func newStaticSystemConfigFetcher(hash common.Hash, config eth.SystemConfig) derive.SystemConfigL2Fetcher {
+	return &staticSystemConfigFetcher{
+		hash:   hash,
+		config: config,
+	}
+}
+
+func (l *staticSystemConfigFetcher) SystemConfigByL2Hash(ctx context.Context, hash common.Hash) (eth.SystemConfig, error) {
+	if hash != l.hash {
+		return eth.SystemConfig{}, errors.New("not found")
+	}
+	return l.config, nil
+}
+
 // Copy of https://github.com/ethereum-optimism/optimism/blob/8b61225d51105b142580d40bde43adde791423b8/op-node/rollup/derive/payload_util.go#L54
 // but takes a header/txs rather than an execution payload.
 func blockToSystemConfig(rollupCfg *rollup.Config, header *types.Header, txs []*types.Transaction) (eth.SystemConfig, error) {
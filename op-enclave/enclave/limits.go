@@ -0,0 +1,250 @@
+package enclave
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/base/op-enclave/op-enclave/framing"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/netutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Resource limits
+//
+// The enclave has a fixed memory allocation, so a single oversized request could make
+// it run out of memory. Requests are limited in size by the transport before they are
+// decoded, witnesses are limited in node count and size before they are executed, and
+// executions are limited in concurrency and wall-clock time. Requests exceeding a limit
+// fail with ErrorCodeLimitExceeded, and the check identifies the limit.
+//
+// core.ExecuteStateless cannot be interrupted, so an execution that times out keeps
+// its slot until the block being executed completes, and the remaining blocks of the
+// range are skipped.
+const (
+	defaultMaxRequestSize          = 256 << 20
+	defaultMaxWitnessNodes         = 1 << 20
+	defaultMaxWitnessBytes         = 128 << 20
+	defaultMaxConcurrentExecutions = 2
+	defaultExecutionTimeout        = 5 * time.Minute
+)
+
+// Limits bounds the resources used by requests.
+type Limits struct {
+	// MaxRequestSize is the maximum size of a JSON-RPC request in bytes.
+	MaxRequestSize int
+	// MaxWitnessNodes is the maximum number of state nodes and codes across the
+	// witnesses of a request.
+	MaxWitnessNodes int
+	// MaxWitnessBytes is the maximum size of the state nodes and codes across the
+	// witnesses of a request.
+	MaxWitnessBytes int
+	// MaxConcurrentExecutions is the maximum number of executions in progress.
+	MaxConcurrentExecutions int
+	// ExecutionTimeout is the deadline for each execution request.
+	ExecutionTimeout time.Duration
+}
+
+// DefaultLimits returns the limits used when none are configured.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxRequestSize:          defaultMaxRequestSize,
+		MaxWitnessNodes:         defaultMaxWitnessNodes,
+		MaxWitnessBytes:         defaultMaxWitnessBytes,
+		MaxConcurrentExecutions: defaultMaxConcurrentExecutions,
+		ExecutionTimeout:        defaultExecutionTimeout,
+	}
+}
+
+// LimitsFromEnv reads the resource limits from the OP_ENCLAVE_MAX_REQUEST_SIZE,
+// OP_ENCLAVE_MAX_WITNESS_NODES, OP_ENCLAVE_MAX_WITNESS_BYTES,
+// OP_ENCLAVE_MAX_CONCURRENT_EXECUTIONS and OP_ENCLAVE_EXECUTION_TIMEOUT env vars.
+func LimitsFromEnv() (Limits, error) {
+	limits := DefaultLimits()
+	for name, limit := range map[string]*int{
+		"OP_ENCLAVE_MAX_REQUEST_SIZE":          &limits.MaxRequestSize,
+		"OP_ENCLAVE_MAX_WITNESS_NODES":         &limits.MaxWitnessNodes,
+		"OP_ENCLAVE_MAX_WITNESS_BYTES":         &limits.MaxWitnessBytes,
+		"OP_ENCLAVE_MAX_CONCURRENT_EXECUTIONS": &limits.MaxConcurrentExecutions,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 10, 31)
+		if err != nil || n == 0 {
+			return Limits{}, fmt.Errorf("invalid %s: %s", name, value)
+		}
+		*limit = int(n)
+	}
+	if timeout := os.Getenv("OP_ENCLAVE_EXECUTION_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return Limits{}, fmt.Errorf("invalid OP_ENCLAVE_EXECUTION_TIMEOUT: %s", timeout)
+		}
+		limits.ExecutionTimeout = d
+	}
+	return limits, nil
+}
+
+// withDefaults replaces unset limits with their defaults.
+func (l Limits) withDefaults() Limits {
+	defaults := DefaultLimits()
+	if l.MaxRequestSize <= 0 {
+		l.MaxRequestSize = defaults.MaxRequestSize
+	}
+	if l.MaxWitnessNodes <= 0 {
+		l.MaxWitnessNodes = defaults.MaxWitnessNodes
+	}
+	if l.MaxWitnessBytes <= 0 {
+		l.MaxWitnessBytes = defaults.MaxWitnessBytes
+	}
+	if l.MaxConcurrentExecutions <= 0 {
+		l.MaxConcurrentExecutions = defaults.MaxConcurrentExecutions
+	}
+	if l.ExecutionTimeout <= 0 {
+		l.ExecutionTimeout = defaults.ExecutionTimeout
+	}
+	return l
+}
+
+func (l Limits) checkWitnessSize(nodes, size int) error {
+	if nodes > l.MaxWitnessNodes {
+		return newError(ErrorCodeLimitExceeded, "max_witness_nodes",
+			fmt.Sprintf("witness has %d nodes, limit is %d", nodes, l.MaxWitnessNodes))
+	}
+	if size > l.MaxWitnessBytes {
+		return newError(ErrorCodeLimitExceeded, "max_witness_bytes",
+			fmt.Sprintf("witness has %d bytes, limit is %d", size, l.MaxWitnessBytes))
+	}
+	return nil
+}
+
+// witnessSize returns the number of state nodes and codes across the witnesses of the
+// blocks, and their total size.
+func witnessSize(blocks []*statelessInput) (nodes int, size int) {
+	for _, block := range blocks {
+		nodes += len(block.witness.State) + len(block.witness.Codes)
+		for node := range block.witness.State {
+			size += len(node)
+		}
+		for code := range block.witness.Codes {
+			size += len(code)
+		}
+	}
+	return nodes, size
+}
+
+// checkWitnessEncoding returns an error if the hex encoded witness exceeds the limits,
+// before it is decoded.
+func (l Limits) checkWitnessEncoding(blocks []*BlockInput) error {
+	nodes, size := 0, 0
+	for _, block := range blocks {
+		if block == nil || block.Witness == nil {
+			continue
+		}
+		nodes += len(block.Witness.State) + len(block.Witness.Codes)
+		for _, node := range block.Witness.State {
+			size += len(node) / 2
+		}
+		for _, code := range block.Witness.Codes {
+			size += len(code) / 2
+		}
+	}
+	return l.checkWitnessSize(nodes, size)
+}
+
+// checkWireWitness returns an error if the witness of a binary payload exceeds the
+// limits, before it is decoded.
+func (l Limits) checkWireWitness(blocks []*wireBlockInput) error {
+	nodes, size := 0, 0
+	for _, block := range blocks {
+		if block == nil || block.Witness == nil {
+			continue
+		}
+		nodes += len(block.Witness.State) + len(block.Witness.Codes)
+		for _, node := range block.Witness.State {
+			size += len(node)
+		}
+		for _, code := range block.Witness.Codes {
+			size += len(code)
+		}
+	}
+	return l.checkWitnessSize(nodes, size)
+}
+
+// execute runs f with the execution timeout, if an execution slot is available. If
+// the deadline passes or ctx is cancelled, execute returns without waiting for f, but
+// f keeps the slot until it returns.
+func (s *Server) execute(ctx context.Context, f func(ctx context.Context) error) error {
+	select {
+	case s.executions <- struct{}{}:
+	default:
+		return newError(ErrorCodeLimitExceeded, "max_concurrent_executions",
+			fmt.Sprintf("too many concurrent executions, limit is %d", s.limits.MaxConcurrentExecutions))
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.limits.ExecutionTimeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		defer func() { <-s.executions }()
+		done <- f(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return contextError(ctx)
+	}
+}
+
+// contextError converts the error of a done context into an enclave Error.
+func contextError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return wrapError(ErrorCodeLimitExceeded, "execution_timeout", "execution deadline exceeded", ctx.Err())
+	}
+	return wrapError(ErrorCodeInternal, "execution", "execution cancelled", ctx.Err())
+}
+
+// ServeListener is rpc.Server.ServeListener, but with length-prefixed framing (see
+// package framing), rejecting requests larger than maxRequestSize before they are read,
+// by closing the connection.
+func ServeListener(server *rpc.Server, l net.Listener, maxRequestSize int) error {
+	for {
+		conn, err := l.Accept()
+		if netutil.IsTemporaryError(err) {
+			log.Warn("RPC accept error", "err", err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		go server.ServeCodec(newFramedCodec(conn, maxRequestSize), 0)
+	}
+}
+
+func newFramedCodec(conn net.Conn, maxRequestSize int) rpc.ServerCodec {
+	encode := func(v interface{}, isErrorResponse bool) error {
+		payload, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return framing.Write(conn, payload)
+	}
+	decode := func(v interface{}) error {
+		payload, err := framing.Read(conn, maxRequestSize)
+		if errors.Is(err, framing.ErrTooLarge) {
+			log.Warn("Rejected request", "err", err)
+		}
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(payload, v)
+	}
+	return rpc.NewFuncCodec(conn, encode, decode)
+}
@@ -0,0 +1,114 @@
+package enclave
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "op_enclave"
+
+// serverMetrics are the Prometheus metrics of the Server.
+type serverMetrics struct {
+	executionDuration   prometheus.Histogram
+	executionBlocks     prometheus.Histogram
+	witnessNodes        prometheus.Histogram
+	witnessBytes        prometheus.Histogram
+	aggregations        prometheus.Counter
+	aggregatedProposals prometheus.Histogram
+	failures            *prometheus.CounterVec
+}
+
+// newServerMetrics registers the metrics with registerer. If it is nil, the metrics are
+// not exported.
+func newServerMetrics(registerer prometheus.Registerer) *serverMetrics {
+	if registerer == nil {
+		registerer = prometheus.NewRegistry()
+	}
+	m := &serverMetrics{
+		executionDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "execution_duration_seconds",
+			Help:      "Duration of stateless executions",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+		}),
+		executionBlocks: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "execution_blocks",
+			Help:      "Number of L2 blocks per stateless execution",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 8),
+		}),
+		witnessNodes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "witness_nodes",
+			Help:      "Number of state nodes and codes per stateless execution",
+			Buckets:   prometheus.ExponentialBuckets(256, 4, 8),
+		}),
+		witnessBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "witness_bytes",
+			Help:      "Size of state nodes and codes per stateless execution",
+			Buckets:   prometheus.ExponentialBuckets(64<<10, 4, 8),
+		}),
+		aggregations: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "aggregations_total",
+			Help:      "Number of aggregations",
+		}),
+		aggregatedProposals: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "aggregated_proposals",
+			Help:      "Number of proposals per aggregation",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 8),
+		}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "failures_total",
+			Help:      "Number of failed requests, by method, error code and check",
+		}, []string{"method", "code", "check"}),
+	}
+	registerer.MustRegister(
+		m.executionDuration,
+		m.executionBlocks,
+		m.witnessNodes,
+		m.witnessBytes,
+		m.aggregations,
+		m.aggregatedProposals,
+		m.failures,
+	)
+	return m
+}
+
+// recordExecution records an execution that started at start. It is intended to be
+// deferred with a pointer to the method's named error result.
+func (m *serverMetrics) recordExecution(start time.Time, blocks int, err *error) {
+	m.executionDuration.Observe(time.Since(start).Seconds())
+	m.executionBlocks.Observe(float64(blocks))
+	m.recordFailure("execute", *err)
+}
+
+func (m *serverMetrics) recordWitness(nodes, size int) {
+	m.witnessNodes.Observe(float64(nodes))
+	m.witnessBytes.Observe(float64(size))
+}
+
+// recordAggregation records an aggregation. It is intended to be deferred with a
+// pointer to the method's named error result.
+func (m *serverMetrics) recordAggregation(proposals int, err *error) {
+	m.aggregations.Inc()
+	m.aggregatedProposals.Observe(float64(proposals))
+	m.recordFailure("aggregate", *err)
+}
+
+func (m *serverMetrics) recordFailure(method string, err error) {
+	if err == nil {
+		return
+	}
+	code, check := "unknown", "unknown"
+	if enclaveErr := ParseError(err); enclaveErr != nil {
+		code = strconv.Itoa(int(enclaveErr.Code))
+		check = enclaveErr.Check
+	}
+	m.failures.WithLabelValues(method, code, check).Inc()
+}
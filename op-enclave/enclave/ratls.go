@@ -0,0 +1,219 @@
+package enclave
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// RA-TLS
+//
+// The enclave terminates TLS itself, with a self-signed certificate whose public key is
+// bound into a Nitro attestation document, which is embedded in the certificate as an
+// extension. Clients verify the attestation (CA roots and PCR0) and that it attests the
+// certificate's key during the handshake, instead of verifying a certificate chain. As
+// the handshake proves possession of the key, this gives an end-to-end channel to an
+// attested enclave, which the host forwarding the traffic cannot read or tamper with.
+//
+// Certificates are regenerated every raTLSCertificateRefresh, so that clients can
+// require attestations to be recent.
+const (
+	raTLSUserDataTag         = "op-enclave/ra-tls"
+	raTLSCertificateRefresh  = time.Minute
+	raTLSCertificateValidity = time.Hour
+)
+
+// raTLSAttestationOID identifies the certificate extension containing the attestation.
+var raTLSAttestationOID = asn1.ObjectIdentifier{1, 3, 9901, 1}
+
+type raTLSCertificates struct {
+	attestor Attestor
+	mutex    sync.Mutex
+	cert     *tls.Certificate
+	created  time.Time
+}
+
+// NewRATLSConfig returns the enclave's TLS config, which presents certificates bound to
+// attestations from the attestor.
+func NewRATLSConfig(attestor Attestor) (*tls.Config, error) {
+	c := &raTLSCertificates{attestor: attestor}
+	if _, err := c.get(nil); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS13,
+		GetCertificate: c.get,
+	}, nil
+}
+
+func (c *raTLSCertificates) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.cert != nil && time.Since(c.created) < raTLSCertificateRefresh {
+		return c.cert, nil
+	}
+	cert, err := newRATLSCertificate(c.attestor)
+	if err != nil {
+		return nil, err
+	}
+	c.cert = cert
+	c.created = time.Now()
+	return cert, nil
+}
+
+func newRATLSCertificate(attestor Attestor) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), attestor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate TLS key: %w", err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal TLS public key: %w", err)
+	}
+	attestation, err := attestor.Attest(publicKey, []byte(raTLSUserDataTag), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attest TLS key: %w", err)
+	}
+	serial := make([]byte, 16)
+	if _, err = attestor.Read(serial); err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: new(big.Int).SetBytes(serial),
+		Subject:      pkix.Name{CommonName: "op-enclave"},
+		DNSNames:     []string{"op-enclave"},
+		NotBefore:    now.Add(-maxAttestationClockSkew),
+		NotAfter:     now.Add(raTLSCertificateValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		ExtraExtensions: []pkix.Extension{{
+			Id:    raTLSAttestationOID,
+			Value: attestation,
+		}},
+	}
+	der, err := x509.CreateCertificate(attestor, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create TLS certificate: %w", err)
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
+
+// RATLSConfig configures the verification of an enclave's RA-TLS certificate.
+type RATLSConfig struct {
+	// Roots is the CA root bundle that attestations must chain to. If nil, the AWS
+	// Nitro Enclaves root is used.
+	Roots *x509.CertPool
+	// PCR0 lists the accepted PCR0 values of the enclave image.
+	PCR0 [][]byte
+	// MaxAge is the maximum age of the attestation. Zero uses the default.
+	MaxAge time.Duration
+}
+
+// TLSConfig returns a client TLS config that verifies the enclave's attestation during
+// the handshake.
+func (c *RATLSConfig) TLSConfig() (*tls.Config, error) {
+	if len(c.PCR0) == 0 {
+		return nil, errors.New("RA-TLS requires at least one PCR0")
+	}
+	roots := c.Roots
+	if roots == nil {
+		roots = defaultRoot
+	}
+	maxAge := c.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultAttestationMaxAge
+	}
+	verifier := &attestationVerifier{
+		policy: AttestationPolicy{
+			PCRs:      []uint{0},
+			Allowlist: map[uint][][]byte{0: c.PCR0},
+			MaxAge:    maxAge,
+		},
+		roots: roots,
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		// the certificate is self-signed, and is verified using its attestation instead
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyRATLSCertificate(verifier, rawCerts)
+		},
+	}, nil
+}
+
+func verifyRATLSCertificate(verifier *attestationVerifier, rawCerts [][]byte) error {
+	if len(rawCerts) == 0 {
+		return errors.New("enclave presented no certificate")
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse enclave certificate: %w", err)
+	}
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return errors.New("enclave certificate is expired or not yet valid")
+	}
+	var attestation []byte
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(raTLSAttestationOID) {
+			attestation = ext.Value
+			break
+		}
+	}
+	if attestation == nil {
+		return errors.New("enclave certificate has no attestation")
+	}
+	verification, err := verifier.verify(attestation, []byte(raTLSUserDataTag), nil)
+	if err != nil {
+		return fmt.Errorf("failed to verify enclave attestation: %w", err)
+	}
+	if !bytes.Equal(verification.Document.PublicKey, cert.RawSubjectPublicKeyInfo) {
+		return errors.New("enclave attestation does not match the certificate key")
+	}
+	return nil
+}
+
+// RATLSClientOption returns an rpc.ClientOption that connects to the enclave over
+// HTTPS, verifying its RA-TLS certificate.
+func RATLSClientOption(cfg RATLSConfig) (rpc.ClientOption, error) {
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	return rpc.WithHTTPClient(&http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   tlsConfig,
+			ForceAttemptHTTP2: true,
+		},
+	}), nil
+}
+
+// DialRATLS connects to the enclave's RA-TLS endpoint (an https:// URL).
+func DialRATLS(ctx context.Context, url string, cfg RATLSConfig) (*Client, error) {
+	option, err := RATLSClientOption(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := rpc.DialOptions(ctx, url, option)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: client}, nil
+}
@@ -13,12 +13,28 @@ import (
 const Namespace = "enclave"
 
 type RPC interface {
+	Status(ctx context.Context) (*Status, error)
 	SignerPublicKey(ctx context.Context) (hexutil.Bytes, error)
 	SignerAttestation(ctx context.Context) (hexutil.Bytes, error)
 	DecryptionPublicKey(ctx context.Context) (hexutil.Bytes, error)
 	DecryptionAttestation(ctx context.Context) (hexutil.Bytes, error)
-	EncryptedSignerKey(ctx context.Context, attestation hexutil.Bytes) (hexutil.Bytes, error)
-	SetSignerKey(ctx context.Context, encrypted hexutil.Bytes) error
+	KeyTransferRequest(ctx context.Context, version *hexutil.Uint64) (hexutil.Bytes, error)
+	EncryptedSignerKey(ctx context.Context, request hexutil.Bytes) (hexutil.Bytes, error)
+	SetSignerKey(ctx context.Context, response hexutil.Bytes) error
+	RotateSignerKey(ctx context.Context) (hexutil.Bytes, error)
+	EscrowSignerKey(ctx context.Context, threshold hexutil.Uint64, custodians []hexutil.Bytes) (hexutil.Bytes, error)
+	EscrowShare(ctx context.Context, escrow hexutil.Bytes, request hexutil.Bytes) (hexutil.Bytes, error)
+	RecoverSignerKey(ctx context.Context, escrow hexutil.Bytes, responses []hexutil.Bytes) (hexutil.Bytes, error)
+	AddTrustedSigner(ctx context.Context, attestation hexutil.Bytes) (common.Address, error)
+	RemoveTrustedSigner(ctx context.Context, signer common.Address) error
+	TrustedSigners(ctx context.Context) ([]common.Address, error)
+	ConfigAllowlist(ctx context.Context) (*ConfigAllowlist, error)
+	UpdateConfigAllowlist(ctx context.Context, update hexutil.Bytes) (hexutil.Bytes, error)
+	SigningJournal(ctx context.Context) ([]*JournalSummary, error)
+	SignedOutputRoot(ctx context.Context, configHash common.Hash, number hexutil.Uint64) (*common.Hash, error)
+	ExportSigningJournal(ctx context.Context) (hexutil.Bytes, error)
+	ImportSigningJournal(ctx context.Context, sealed hexutil.Bytes) error
+	WireFormats(ctx context.Context) ([]WireFormat, error)
 	ExecuteStateless(
 		ctx context.Context,
 		config *PerChainConfig,
@@ -29,7 +45,75 @@ type RPC interface {
 		sequencedTxs []hexutil.Bytes,
 		witness *stateless.ExecutionWitness,
 		messageAccount *eth.AccountResult,
-		prevMessageAccountHash common.Hash,
+		prevMessageAccount *eth.AccountResult,
 	) (*Proposal, error)
-	Aggregate(ctx context.Context, configHash common.Hash, prevOutputRoot common.Hash, proposals []*Proposal) (*Proposal, error)
+	ExecuteStatelessRange(
+		ctx context.Context,
+		config *PerChainConfig,
+		prevMessageAccount *eth.AccountResult,
+		blocks []*BlockInput,
+	) (*Proposal, error)
+	ExecuteStatelessBinary(ctx context.Context, payload []byte) (*Proposal, error)
+	Aggregate(ctx context.Context, configHash common.Hash, prevOutputRoot common.Hash, proposals []*Proposal, config *PerChainConfig) (*Proposal, error)
+	AggregateBinary(ctx context.Context, payload []byte) (*Proposal, error)
+}
+
+// PlaintextReadOnlyFromEnv returns true if the OP_ENCLAVE_PLAINTEXT_READ_ONLY env var
+// limits the plaintext vsock endpoint to the ReadOnlyAPI.
+func PlaintextReadOnlyFromEnv() (bool, error) {
+	return envBool("OP_ENCLAVE_PLAINTEXT_READ_ONLY")
+}
+
+// ReadOnlyAPI is the subset of the RPC that can be served on the plaintext vsock
+// endpoint, whose traffic the host can read and modify, instead of the full API (see
+// PlaintextReadOnlyFromEnv). It is limited to status and public keys, which are either
+// public or attested. This only reduces what is exposed in plaintext, and is not access
+// control: RA-TLS authenticates the enclave to the client, but not the client to the
+// enclave, so the host can still call every method over its own RA-TLS session.
+type ReadOnlyAPI struct {
+	s *Server
+}
+
+func NewReadOnlyAPI(s *Server) *ReadOnlyAPI {
+	return &ReadOnlyAPI{s: s}
+}
+
+func (a *ReadOnlyAPI) Status(ctx context.Context) (*Status, error) {
+	return a.s.Status(ctx)
+}
+
+func (a *ReadOnlyAPI) SignerPublicKey(ctx context.Context) (hexutil.Bytes, error) {
+	return a.s.SignerPublicKey(ctx)
+}
+
+func (a *ReadOnlyAPI) SignerAttestation(ctx context.Context) (hexutil.Bytes, error) {
+	return a.s.SignerAttestation(ctx)
+}
+
+func (a *ReadOnlyAPI) DecryptionPublicKey(ctx context.Context) (hexutil.Bytes, error) {
+	return a.s.DecryptionPublicKey(ctx)
+}
+
+func (a *ReadOnlyAPI) DecryptionAttestation(ctx context.Context) (hexutil.Bytes, error) {
+	return a.s.DecryptionAttestation(ctx)
+}
+
+func (a *ReadOnlyAPI) TrustedSigners(ctx context.Context) ([]common.Address, error) {
+	return a.s.TrustedSigners(ctx)
+}
+
+func (a *ReadOnlyAPI) ConfigAllowlist(ctx context.Context) (*ConfigAllowlist, error) {
+	return a.s.ConfigAllowlist(ctx)
+}
+
+func (a *ReadOnlyAPI) SigningJournal(ctx context.Context) ([]*JournalSummary, error) {
+	return a.s.SigningJournal(ctx)
+}
+
+func (a *ReadOnlyAPI) SignedOutputRoot(ctx context.Context, configHash common.Hash, number hexutil.Uint64) (*common.Hash, error) {
+	return a.s.SignedOutputRoot(ctx, configHash, number)
+}
+
+func (a *ReadOnlyAPI) WireFormats(ctx context.Context) ([]WireFormat, error) {
+	return a.s.WireFormats(ctx)
 }
@@ -0,0 +1,32 @@
+package enclave
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestReadOnlyAPI(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, testPCRs(1))
+	server := rpc.NewServer()
+	if err := server.RegisterName(Namespace, NewReadOnlyAPI(s)); err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{Client: rpc.DialInProc(server)}
+	defer client.Close()
+
+	if _, err := client.Status(ctx); err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if _, err := client.SignerAttestation(ctx); err != nil {
+		t.Fatalf("SignerAttestation: %v", err)
+	}
+	if _, err := client.RotateSignerKey(ctx); !IsMethodNotFound(err) {
+		t.Fatalf("RotateSignerKey is served by the read-only API: %v", err)
+	}
+	if err := client.SetSignerKey(ctx, nil); !IsMethodNotFound(err) {
+		t.Fatalf("SetSignerKey is served by the read-only API: %v", err)
+	}
+}
@@ -5,18 +5,18 @@ import (
 	"bytes"
 	"context"
 	"crypto/ecdsa"
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
-	"errors"
 	"fmt"
 	"io"
 	"math/big"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/base/op-enclave/op-enclave/signing"
 	"github.com/ethereum-optimism/optimism/op-service/eth"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -24,18 +24,15 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
-	"github.com/hf/nitrite"
-	"github.com/hf/nsm"
-	"github.com/hf/nsm/request"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
 	// DefaultCARoots contains the PEM encoded roots for verifying Nitro
 	// Enclave attestation signatures. You can download them from
 	// https://docs.aws.amazon.com/enclaves/latest/user/verify-root.html
-	DefaultCARoots         = "UEsDBBQAAAAIALkYV1GVtvolRwIAAAkDAAAIABwAcm9vdC5wZW1VVAkAA10ekl9dHpJfdXgLAAEESHEtDwQUAAAAZZJLk6JQDIX3/IrZW10Igo2LWdwXiBoE5HXZCSq0iNgKfYVfP9guJ8tTqS85Ofn4GAszy3b+EOYHtmkTFLCX+CGBbRMWEILSfYGEjVFh+8itnoe4yKq1XC7DDNptcJ2YXJCC2+smtYfzlCEBYhewjQSospASMlwCiSJ40gE5uHAijBrAldny5PaTnRkAan77iBDUiw4B+A9heZxKkedRilflYQZdVl+meW20aayfM8tU0wTEsswdCKonUFuDAPotRUo8ag59axIE3ls84xV4D0FG6gi1mFhF4cBcQNP35GIcGCvlsV504ImXnVffRqLjxpECT2tA6Xt1AFabs7zXu33i91mvXLLaefAkveQDVgEjC/ff1g60BSqYJeFdhzFCX0i1EXYFibZdTWA57Jf0q26/vZ+Ka3BbDVlz2chy2qv8wnYK9vVgVz1OWSZpBjFi3PTtp6li8Xlk7X7vTprSUrNr+FgspofpKlGNIHe9hDA3nWGE7WPgcsEaEqdMKo2LzhtPBHkoL9YOgTEgKkZ//jRA3lLGKBRIMCwP6PCyuPQ0ZhZeWJFYoYfKlPzJMRZ6Ns9vM7feX087nQta/ALcN8CjqLCsV4yEvL2Pd6JIrRBYnEjgkfOpn/hNXi+S7qjxq4hrZxUhTTuhqavH6vbGG7HYchL5e3b82RjdVkn4vdOfLbixdD8BGSFfhv6IcbYS63Vy2M3xrfXMLs2Cz1kjF7hUvsPnRb46d0UNtwY/iftcuJtsMnckW2yGmcz/Sr+fzRz637f/A1BLAQIeAxQAAAAIALkYV1GVtvolRwIAAAkDAAAIABgAAAAAAAEAAACkgQAAAAByb290LnBlbVVUBQADXR6SX3V4CwABBEhxLQ8EFAAAAFBLBQYAAAAAAQABAE4AAACJAgAAAAA="
-	DefaultCARootsSHA256   = "8cf60e2b2efca96c6a9e71e851d00c1b6991cc09eadbe64a6a1d1b1eb9faff7c"
-	maxSequencerDriftFjord = 1800
+	DefaultCARoots       = "UEsDBBQAAAAIALkYV1GVtvolRwIAAAkDAAAIABwAcm9vdC5wZW1VVAkAA10ekl9dHpJfdXgLAAEESHEtDwQUAAAAZZJLk6JQDIX3/IrZW10Igo2LWdwXiBoE5HXZCSq0iNgKfYVfP9guJ8tTqS85Ofn4GAszy3b+EOYHtmkTFLCX+CGBbRMWEILSfYGEjVFh+8itnoe4yKq1XC7DDNptcJ2YXJCC2+smtYfzlCEBYhewjQSospASMlwCiSJ40gE5uHAijBrAldny5PaTnRkAan77iBDUiw4B+A9heZxKkedRilflYQZdVl+meW20aayfM8tU0wTEsswdCKonUFuDAPotRUo8ag59axIE3ls84xV4D0FG6gi1mFhF4cBcQNP35GIcGCvlsV504ImXnVffRqLjxpECT2tA6Xt1AFabs7zXu33i91mvXLLaefAkveQDVgEjC/ff1g60BSqYJeFdhzFCX0i1EXYFibZdTWA57Jf0q26/vZ+Ka3BbDVlz2chy2qv8wnYK9vVgVz1OWSZpBjFi3PTtp6li8Xlk7X7vTprSUrNr+FgspofpKlGNIHe9hDA3nWGE7WPgcsEaEqdMKo2LzhtPBHkoL9YOgTEgKkZ//jRA3lLGKBRIMCwP6PCyuPQ0ZhZeWJFYoYfKlPzJMRZ6Ns9vM7feX087nQta/ALcN8CjqLCsV4yEvL2Pd6JIrRBYnEjgkfOpn/hNXi+S7qjxq4hrZxUhTTuhqavH6vbGG7HYchL5e3b82RjdVkn4vdOfLbixdD8BGSFfhv6IcbYS63Vy2M3xrfXMLs2Cz1kjF7hUvsPnRb46d0UNtwY/iftcuJtsMnckW2yGmcz/Sr+fzRz637f/A1BLAQIeAxQAAAAIALkYV1GVtvolRwIAAAkDAAAIABgAAAAAAAEAAACkgQAAAAByb290LnBlbVVUBQADXR6SX3V4CwABBEhxLQ8EFAAAAFBLBQYAAAAAAQABAE4AAACJAgAAAAA="
+	DefaultCARootsSHA256 = "8cf60e2b2efca96c6a9e71e851d00c1b6991cc09eadbe64a6a1d1b1eb9faff7c"
 )
 
 var (
@@ -70,163 +67,189 @@ func createAWSNitroRoot() *x509.CertPool {
 	return pool
 }
 
+// ServerConfig contains the configuration for the enclave Server.
+type ServerConfig struct {
+	Attestor          Attestor
+	AttestationPolicy AttestationPolicy
+	ConfigAllowlist   ConfigAllowlistConfig
+	// JournalSize is the number of signing journal entries kept per config hash.
+	JournalSize int
+	// SignerKeyOverlap is how long the previous signer key is accepted by Aggregate
+	// after RotateSignerKey.
+	SignerKeyOverlap time.Duration
+	// TrustedSigners are peer enclave signers whose proposals are accepted by Aggregate.
+	TrustedSigners []common.Address
+	// Limits bounds the resources used by requests. Unset limits use their defaults.
+	Limits Limits
+	// Metrics registers the Server's Prometheus metrics. If nil, metrics are not exported.
+	Metrics prometheus.Registerer
+}
+
+// ServerConfigFromEnv creates a ServerConfig using the default Attestor,
+// configured using OP_ENCLAVE_* env vars.
+func ServerConfigFromEnv() (ServerConfig, error) {
+	attestor, err := NewDefaultAttestor()
+	if err != nil {
+		return ServerConfig{}, fmt.Errorf("failed to create attestor: %w", err)
+	}
+	policy, err := AttestationPolicyFromEnv()
+	if err != nil {
+		return ServerConfig{}, fmt.Errorf("failed to parse attestation policy: %w", err)
+	}
+	allowlist, err := ConfigAllowlistConfigFromEnv()
+	if err != nil {
+		return ServerConfig{}, fmt.Errorf("failed to parse config allowlist: %w", err)
+	}
+	journalSize, err := JournalSizeFromEnv()
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	overlap, err := SignerKeyOverlapFromEnv()
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	trustedSigners, err := TrustedSignersFromEnv()
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	limits, err := LimitsFromEnv()
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	return ServerConfig{
+		Attestor:          attestor,
+		AttestationPolicy: policy,
+		ConfigAllowlist:   allowlist,
+		JournalSize:       journalSize,
+		SignerKeyOverlap:  overlap,
+		TrustedSigners:    trustedSigners,
+		Limits:            limits,
+	}, nil
+}
+
 type Server struct {
+	attestor      Attestor
+	verifier      *attestationVerifier
+	clock         *trustedClock
 	pcr0          []byte
-	signerKey     *ecdsa.PrivateKey
-	decryptionKey *rsa.PrivateKey
+	decryptionKey *ecdsa.PrivateKey
+	allowlist     *configAllowlist
+	journal       *signingJournal
+
+	signer           signerKeys
+	signerKeyOverlap time.Duration
+	trusted          *trustedSigners
+	instanceID       common.Hash
+	sequence         atomic.Uint64
+
+	limits     Limits
+	executions chan struct{}
+
+	keyTransferMutex sync.Mutex
+	keyTransfers     map[string]*pendingKeyTransfer
+
+	// domainConfigs records the hashes of configs with a signing domain that this
+	// enclave has signed for, which Aggregate requires the config of
+	domainConfigsMutex sync.Mutex
+	domainConfigs      map[common.Hash]struct{}
+
+	counters serverCounters
+	metrics  *serverMetrics
 }
 
 var _ RPC = (*Server)(nil)
 
-func NewServer() (*Server, error) {
-	var random io.Reader
-	var pcr0 []byte
-	session, err := nsm.OpenDefaultSession()
-	var signerKeyEnv string
+func NewServer(cfg ServerConfig) (*Server, error) {
+	attestor := cfg.Attestor
+	pcr0, err := attestor.PCR(0)
 	if err != nil {
-		log.Warn("failed to open Nitro Secure Module session, running in local mode", "error", err)
-		random = rand.Reader
-		// only allow a signer key to be set in local mode
-		signerKeyEnv = os.Getenv("OP_ENCLAVE_SIGNER_KEY")
-	} else {
-		defer func() {
-			_ = session.Close()
-		}()
-		pcr, err := session.Send(&request.DescribePCR{
-			Index: 0,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to describe PCR: %w", err)
-		}
-		if pcr.Error != "" {
-			return nil, fmt.Errorf("NSM device returned an error: %s", pcr.Error)
-		}
-		if pcr.DescribePCR == nil || pcr.DescribePCR.Data == nil || len(pcr.DescribePCR.Data) == 0 {
-			return nil, errors.New("NSM device did not return PCR data")
-		}
-		pcr0 = pcr.DescribePCR.Data
-		random = session
+		return nil, fmt.Errorf("failed to read PCR0: %w", err)
+	}
+	clock := newTrustedClock(cfg.AttestationPolicy)
+	verifier, err := newAttestationVerifier(cfg.AttestationPolicy, attestor, clock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create attestation verifier: %w", err)
 	}
 
-	decryptionKey, err := rsa.GenerateKey(random, 4096)
+	decryptionKey, err := ecdsa.GenerateKey(crypto.S256(), attestor)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate decryption key: %w", err)
 	}
-	signerKey, err := ecdsa.GenerateKey(crypto.S256(), random)
+	signerKey, err := ecdsa.GenerateKey(crypto.S256(), attestor)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate signer key: %w", err)
 	}
-	if signerKeyEnv != "" {
+	// only allow a signer key to be set in local mode
+	if signerKeyEnv := os.Getenv("OP_ENCLAVE_SIGNER_KEY"); attestor.Local() && signerKeyEnv != "" {
 		signerKey, err = crypto.HexToECDSA(signerKeyEnv)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse signer key: %w", err)
 		}
 	}
 	log.Info("Generated signer key", "address", crypto.PubkeyToAddress(signerKey.PublicKey).Hex())
+	allowlist, err := newConfigAllowlist(cfg.ConfigAllowlist, attestor)
+	if err != nil {
+		return nil, err
+	}
+	var instanceID common.Hash
+	if _, err = io.ReadFull(attestor, instanceID[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate instance ID: %w", err)
+	}
+	limits := cfg.Limits.withDefaults()
 	return &Server{
+		attestor:      attestor,
+		verifier:      verifier,
+		clock:         clock,
 		pcr0:          pcr0,
-		signerKey:     signerKey,
 		decryptionKey: decryptionKey,
+		allowlist:     allowlist,
+		journal:       newSigningJournal(cfg.JournalSize),
+		signer: signerKeys{
+			current: signerKey,
+		},
+		signerKeyOverlap: cfg.SignerKeyOverlap,
+		trusted:          newTrustedSigners(cfg.TrustedSigners),
+		instanceID:       instanceID,
+		limits:           limits,
+		executions:       make(chan struct{}, limits.MaxConcurrentExecutions),
+		keyTransfers:     make(map[string]*pendingKeyTransfer),
+		domainConfigs:    make(map[common.Hash]struct{}),
+		counters: serverCounters{
+			start: time.Now(),
+		},
+		metrics: newServerMetrics(cfg.Metrics),
 	}, nil
 }
 
 func (s *Server) SignerPublicKey(ctx context.Context) (hexutil.Bytes, error) {
-	return crypto.FromECDSAPub(&s.signerKey.PublicKey), nil
+	return crypto.FromECDSAPub(&s.signer.get().PublicKey), nil
 }
 
+// SignerAttestation returns an attestation of the signer public key, with
+// signerAttestationTag as user data.
 func (s *Server) SignerAttestation(ctx context.Context) (hexutil.Bytes, error) {
-	return s.publicKeyAttestation(ctx, s.SignerPublicKey)
+	return s.publicKeyAttestation(ctx, s.SignerPublicKey, []byte(signerAttestationTag))
 }
 
 func (s *Server) DecryptionPublicKey(ctx context.Context) (hexutil.Bytes, error) {
-	return x509.MarshalPKIXPublicKey(s.decryptionKey.Public())
+	return crypto.FromECDSAPub(&s.decryptionKey.PublicKey), nil
 }
 
 func (s *Server) DecryptionAttestation(ctx context.Context) (hexutil.Bytes, error) {
-	return s.publicKeyAttestation(ctx, s.DecryptionPublicKey)
+	return s.publicKeyAttestation(ctx, s.DecryptionPublicKey, []byte(decryptionAttestationTag))
 }
 
-func (s *Server) publicKeyAttestation(ctx context.Context, publicKey func(ctx context.Context) (hexutil.Bytes, error)) (hexutil.Bytes, error) {
-	session, err := nsm.OpenDefaultSession()
-	if err != nil {
-		return nil, fmt.Errorf("failed to open session: %w", err)
-	}
-	defer func() {
-		_ = session.Close()
-	}()
+func (s *Server) publicKeyAttestation(ctx context.Context, publicKey func(ctx context.Context) (hexutil.Bytes, error), userData []byte) (hexutil.Bytes, error) {
 	public, err := publicKey(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get public key: %w", err)
 	}
-	res, err := session.Send(&request.Attestation{
-		PublicKey: public,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get attestation: %w", err)
-	}
-	if res.Error != "" {
-		return nil, fmt.Errorf("NSM device returned an error: %s", res.Error)
-	}
-	if res.Attestation == nil || res.Attestation.Document == nil {
-		return nil, errors.New("NSM device did not return an attestation")
-	}
-	return res.Attestation.Document, nil
-}
-
-func (s *Server) EncryptedSignerKey(ctx context.Context, attestation hexutil.Bytes) (hexutil.Bytes, error) {
-	verification, err := nitrite.Verify(
-		attestation,
-		nitrite.VerifyOptions{
-			Roots:       defaultRoot,
-			CurrentTime: time.Now(),
-		},
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to verify attestation: %w", err)
-	}
-	if !bytes.Equal(verification.Document.PCRs[0], s.pcr0) {
-		return nil, errors.New("attestation does not match PCR0")
-	}
-	publicKey, err := x509.ParsePKIXPublicKey(verification.Document.PublicKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse public key: %w", err)
-	}
-	public, ok := publicKey.(*rsa.PublicKey)
-	if !ok {
-		return nil, errors.New("public key is not RSA")
-	}
-	session, err := nsm.OpenDefaultSession()
-	if err != nil {
-		return nil, fmt.Errorf("failed to open session: %w", err)
-	}
-	defer func() {
-		_ = session.Close()
-	}()
-	ciphertext, err := rsa.EncryptPKCS1v15(session, public, crypto.FromECDSA(s.signerKey))
-	if err != nil {
-		return nil, fmt.Errorf("failed to encrypt key: %w", err)
-	}
-	return ciphertext, nil
+	return s.attestor.Attest(public, userData, nil)
 }
 
-func (s *Server) SetSignerKey(ctx context.Context, encrypted hexutil.Bytes) error {
-	session, err := nsm.OpenDefaultSession()
-	if err != nil {
-		return fmt.Errorf("failed to open session: %w", err)
-	}
-	defer func() {
-		_ = session.Close()
-	}()
-	decrypted, err := rsa.DecryptPKCS1v15(session, s.decryptionKey, encrypted)
-	if err != nil {
-		return fmt.Errorf("failed to decrypt key: %w", err)
-	}
-	key, err := crypto.ToECDSA(decrypted)
-	if err != nil {
-		return fmt.Errorf("failed to convert key: %w", err)
-	}
-	s.signerKey = key
-	return nil
+// WireFormats returns the wire formats supported by this Server.
+func (s *Server) WireFormats(ctx context.Context) ([]WireFormat, error) {
+	return wireFormatPreference, nil
 }
 
 type Proposal struct {
@@ -234,6 +257,23 @@ type Proposal struct {
 	Signature     hexutil.Bytes
 	L1OriginHash  common.Hash
 	L2BlockNumber *hexutil.Big
+	// Envelope is set on proposals signed by the enclave, and is not required in the
+	// proposals passed to Aggregate.
+	Envelope *Envelope `json:",omitempty"`
+}
+
+// BlockInput contains the inputs required to statelessly execute a single L2 block.
+// L1OriginChain is only required if the L1 origin advanced by more than one block from
+// the parent's L1 origin, and contains the L1 blocks in between, oldest first.
+type BlockInput struct {
+	L1Origin         *types.Header               `json:"l1_origin"`
+	L1Receipts       types.Receipts              `json:"l1_receipts"`
+	L1OriginChain    []*L1Block                  `json:"l1_origin_chain,omitempty"`
+	PreviousBlockTxs []hexutil.Bytes             `json:"previous_block_txs"`
+	BlockHeader      *types.Header               `json:"block_header"`
+	SequencedTxs     []hexutil.Bytes             `json:"sequenced_txs"`
+	Witness          *stateless.ExecutionWitness `json:"witness"`
+	MessageAccount   *eth.AccountResult          `json:"message_account"`
 }
 
 func (s *Server) ExecuteStateless(
@@ -246,60 +286,243 @@ func (s *Server) ExecuteStateless(
 	sequencedTxs []hexutil.Bytes,
 	witness *stateless.ExecutionWitness,
 	messageAccount *eth.AccountResult,
-	prevMessageAccountHash common.Hash,
+	prevMessageAccount *eth.AccountResult,
+) (*Proposal, error) {
+	return s.ExecuteStatelessRange(ctx, cfg, prevMessageAccount, []*BlockInput{{
+		L1Origin:         l1Origin,
+		L1Receipts:       l1Receipts,
+		PreviousBlockTxs: previousBlockTxs,
+		BlockHeader:      blockHeader,
+		SequencedTxs:     sequencedTxs,
+		Witness:          witness,
+		MessageAccount:   messageAccount,
+	}})
+}
+
+// ExecuteStatelessRange executes a contiguous range of L2 blocks in order, and signs a
+// single proposal from the parent of the first block to the last block. Each block must
+// be a child of the previous one. prevMessageAccount is verified against the state root
+// of the first block's parent, and as each block's message account is verified against
+// its state root, the output roots chain together from the parent onwards.
+func (s *Server) ExecuteStatelessRange(
+	ctx context.Context,
+	cfg *PerChainConfig,
+	prevMessageAccount *eth.AccountResult,
+	blocks []*BlockInput,
 ) (*Proposal, error) {
-	codes, err := transformMap(witness.Codes)
+	// check the witness size before decoding it
+	if err := s.limits.checkWitnessEncoding(blocks); err != nil {
+		return nil, err
+	}
+	inputs, err := newStatelessInputs(blocks)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode witness: %w", err)
+		return nil, err
 	}
-	state, err := transformMap(witness.State)
+	return s.executeStatelessRange(ctx, cfg, prevMessageAccount, inputs)
+}
+
+func newStatelessInputs(blocks []*BlockInput) ([]*statelessInput, error) {
+	inputs := make([]*statelessInput, len(blocks))
+	for i, block := range blocks {
+		if block == nil || block.L1Origin == nil || block.BlockHeader == nil || block.Witness == nil {
+			return nil, newError(ErrorCodeInvalidRequest, "blocks", fmt.Sprintf("block %d is missing its l1 origin, header or witness", i))
+		}
+		codes, err := transformMap(block.Witness.Codes)
+		if err != nil {
+			return nil, wrapError(ErrorCodeInvalidRequest, "witness", "failed to decode witness", err)
+		}
+		state, err := transformMap(block.Witness.State)
+		if err != nil {
+			return nil, wrapError(ErrorCodeInvalidRequest, "witness", "failed to decode witness", err)
+		}
+		inputs[i] = &statelessInput{
+			BlockInput: block,
+			witness: &stateless.Witness{
+				Headers: block.Witness.Headers,
+				Codes:   codes,
+				State:   state,
+			},
+		}
+	}
+	return inputs, nil
+}
+
+// ExecuteStatelessBinary is ExecuteStatelessRange with the arguments encoded as a
+// binary payload (see EncodeExecuteStateless). The payload is a []byte rather than
+// hexutil.Bytes so that it is base64 encoded in the JSON-RPC request.
+func (s *Server) ExecuteStatelessBinary(ctx context.Context, payload []byte) (*Proposal, error) {
+	cfg, prevMessageAccount, blocks, err := decodeExecuteStateless(payload, s.limits)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode witness: %w", err)
+		return nil, payloadError(err)
+	}
+	return s.executeStatelessRange(ctx, cfg, prevMessageAccount, blocks)
+}
+
+func (s *Server) executeStatelessRange(
+	ctx context.Context,
+	cfg *PerChainConfig,
+	prevMessageAccount *eth.AccountResult,
+	blocks []*statelessInput,
+) (_ *Proposal, err error) {
+	defer s.counters.record(&s.counters.executions, &err)
+	defer s.metrics.recordExecution(time.Now(), len(blocks), &err)
+	if len(blocks) == 0 {
+		return nil, newError(ErrorCodeInvalidRequest, "blocks", "no blocks")
 	}
-	w := &stateless.Witness{
-		Headers: witness.Headers,
-		Codes:   codes,
-		State:   state,
+	if err = cfg.Check(); err != nil {
+		return nil, wrapError(ErrorCodeInvalidRequest, "config", "invalid config", err)
 	}
 
 	config := NewChainConfig(cfg)
-	l1OriginHash := l1Origin.Hash()
-	previousBlockHeader := w.Headers[0]
-
-	err = ExecuteStateless(ctx, config.ChainConfig, config.ToRollupConfig(),
-		l1Origin, l1Receipts, previousBlockTxs, blockHeader, sequencedTxs, w, messageAccount)
-	if err != nil {
+	configHash := config.Hash()
+	if err = s.allowlist.check(configHash); err != nil {
 		return nil, err
 	}
 
-	prevOutputRoot := OutputRootV0(previousBlockHeader, prevMessageAccountHash)
-	outputRoot := OutputRootV0(blockHeader, messageAccount.StorageHash)
-	configHash := config.Hash()
-	l2BlockNumber := common.BytesToHash(blockHeader.Number.Bytes())
+	nodes, size := witnessSize(blocks)
+	s.metrics.recordWitness(nodes, size)
+	if err = s.limits.checkWitnessSize(nodes, size); err != nil {
+		return nil, err
+	}
 
-	data := append(configHash[:], l1OriginHash[:]...)
-	data = append(data, l2BlockNumber[:]...)
-	data = append(data, prevOutputRoot[:]...)
-	data = append(data, outputRoot[:]...)
-	sig, err := crypto.Sign(crypto.Keccak256(data), s.signerKey)
+	var prevOutputRoot common.Hash
+	err = s.execute(ctx, func(ctx context.Context) (err error) {
+		prevOutputRoot, _, err = executeBlocks(ctx, config, prevMessageAccount, blocks)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign: %w", err)
+		return nil, err
 	}
 
+	last := blocks[len(blocks)-1]
+	l1OriginHash := last.L1Origin.Hash()
+	outputRoot := OutputRootV0(last.BlockHeader, last.MessageAccount.StorageHash)
+	requestDigest, err := executionRequestDigest(configHash, prevMessageAccount, blocks)
 	if err != nil {
+		return nil, wrapError(ErrorCodeInternal, "request_digest", "failed to hash request", err)
+	}
+	if err = s.journal.record(configHash, last.BlockHeader.Number.Uint64(), outputRoot); err != nil {
 		return nil, err
 	}
-	return &Proposal{
-		OutputRoot:    outputRoot,
-		Signature:     sig,
-		L1OriginHash:  l1OriginHash,
-		L2BlockNumber: (*hexutil.Big)(blockHeader.Number),
-	}, nil
+	version, domain := cfg.Signing()
+	if domain != nil {
+		s.recordDomainConfig(configHash)
+	}
+	proposal, err := s.signProposal(version, domain, &signing.Proposal{
+		ConfigHash:     configHash,
+		L1OriginHash:   l1OriginHash,
+		L2BlockNumber:  last.BlockHeader.Number,
+		PrevOutputRoot: prevOutputRoot,
+		OutputRoot:     outputRoot,
+	}, requestDigest)
+	if err != nil {
+		return nil, wrapError(ErrorCodeInternal, "signature", "failed to sign proposal", err)
+	}
+	s.clock.observe(last.L1Origin)
+	return proposal, nil
+}
+
+// executeBlocks statelessly executes a contiguous range of blocks, returning the output
+// root of the parent of the first block. On failure, it also returns the index of the
+// block that failed.
+func executeBlocks(ctx context.Context, config *ChainConfig, prevMessageAccount *eth.AccountResult, blocks []*statelessInput) (common.Hash, int, error) {
+	rollupConfig := config.ToRollupConfig()
+	var prevOutputRoot common.Hash
+	for i, block := range blocks {
+		if ctx.Err() != nil {
+			return common.Hash{}, i, contextError(ctx)
+		}
+
+		w := block.witness
+		if len(w.Headers) == 0 {
+			return common.Hash{}, i, newError(ErrorCodeInputMismatch, "witness", "witness has no headers")
+		}
+
+		if i == 0 {
+			// the previous output root is signed, so its storage hash must be proven
+			if err := verifyMessageAccount(prevMessageAccount, w.Headers[0].Root, "prev_message_account"); err != nil {
+				return common.Hash{}, i, err
+			}
+			prevOutputRoot = OutputRootV0(w.Headers[0], prevMessageAccount.StorageHash)
+		} else if parentHash := blocks[i-1].BlockHeader.Hash(); block.BlockHeader.ParentHash != parentHash {
+			return common.Hash{}, i, newMismatchError(ErrorCodeInputMismatch, "block_range",
+				fmt.Sprintf("block %s is not a child of block %s", block.BlockHeader.Number, blocks[i-1].BlockHeader.Number),
+				block.BlockHeader.ParentHash, parentHash)
+		}
+
+		err := ExecuteStateless(ctx, config.ChainConfig, rollupConfig, block.L1Origin, block.L1Receipts, block.L1OriginChain,
+			block.PreviousBlockTxs, block.BlockHeader, block.SequencedTxs, w, block.MessageAccount)
+		if err != nil {
+			return common.Hash{}, i, err
+		}
+	}
+	return prevOutputRoot, 0, nil
 }
 
-func (s *Server) Aggregate(ctx context.Context, configHash common.Hash, prevOutputRoot common.Hash, proposals []*Proposal) (*Proposal, error) {
+// AggregateBinary is Aggregate with the arguments encoded as a binary payload
+// (see EncodeAggregate).
+func (s *Server) AggregateBinary(ctx context.Context, payload []byte) (*Proposal, error) {
+	configHash, prevOutputRoot, proposals, config, err := decodeAggregate(payload, s.limits.MaxRequestSize)
+	if err != nil {
+		return nil, payloadError(err)
+	}
+	return s.Aggregate(ctx, configHash, prevOutputRoot, proposals, config)
+}
+
+// recordDomainConfig records that the config with the given hash has a signing domain.
+func (s *Server) recordDomainConfig(configHash common.Hash) {
+	s.domainConfigsMutex.Lock()
+	defer s.domainConfigsMutex.Unlock()
+	s.domainConfigs[configHash] = struct{}{}
+}
+
+func (s *Server) isDomainConfig(configHash common.Hash) bool {
+	s.domainConfigsMutex.Lock()
+	defer s.domainConfigsMutex.Unlock()
+	_, ok := s.domainConfigs[configHash]
+	return ok
+}
+
+// Aggregate combines consecutive proposals into a single proposal. The config with the
+// given hash is required for configs with a SigningDomain, whose proposals are signed
+// with EIP-712 typed data; without it, proposals are signed with the legacy encoding.
+// Omitting the config of a config with a signing domain that this enclave has signed
+// for is rejected, so that its proposals cannot be aggregated with the legacy encoding.
+// The proposals of other configs are verified with the legacy encoding, which typed
+// data signatures of a config with a signing domain do not pass.
+func (s *Server) Aggregate(ctx context.Context, configHash common.Hash, prevOutputRoot common.Hash, proposals []*Proposal, config *PerChainConfig) (_ *Proposal, err error) {
+	defer s.counters.record(&s.counters.aggregations, &err)
+	defer s.metrics.recordAggregation(len(proposals), &err)
 	if len(proposals) == 0 {
-		return nil, errors.New("no proposals")
+		return nil, newError(ErrorCodeInvalidRequest, "proposals", "no proposals")
+	}
+	for i, p := range proposals {
+		if p == nil || p.L2BlockNumber == nil || !p.L2BlockNumber.ToInt().IsUint64() {
+			return nil, newError(ErrorCodeInvalidRequest, "proposals", fmt.Sprintf("proposal %d is missing or has an invalid L2 block number", i))
+		}
+	}
+	version, domain := signing.Version0, (*signing.Domain)(nil)
+	if config != nil {
+		if err = config.Check(); err != nil {
+			return nil, wrapError(ErrorCodeInvalidRequest, "config", "invalid config", err)
+		}
+		if hash := NewChainConfig(config).Hash(); hash != configHash {
+			return nil, newMismatchError(ErrorCodeInputMismatch, "config_hash", "config does not match config hash", configHash, hash)
+		}
+		version, domain = config.Signing()
+		if domain != nil {
+			s.recordDomainConfig(configHash)
+		}
+	} else if s.isDomainConfig(configHash) {
+		return nil, newError(ErrorCodeInvalidRequest, "config", "config is required for configs with a signing domain")
+	}
+	if err = s.allowlist.check(configHash); err != nil {
+		return nil, err
+	}
+	for _, p := range proposals {
+		if err = s.journal.check(configHash, p.L2BlockNumber.ToInt().Uint64(), p.OutputRoot); err != nil {
+			return nil, err
+		}
 	}
 	if len(proposals) == 1 {
 		return proposals[0], nil
@@ -307,35 +530,43 @@ func (s *Server) Aggregate(ctx context.Context, configHash common.Hash, prevOutp
 
 	outputRoot := prevOutputRoot
 	var l1OriginHash common.Hash
-	var l2BlockNumber common.Hash
+	var number *big.Int
 	for _, p := range proposals {
 		l1OriginHash = p.L1OriginHash
-		l2BlockNumber = common.BytesToHash(p.L2BlockNumber.ToInt().Bytes())
-		data := append(configHash[:], l1OriginHash[:]...)
-		data = append(data, l2BlockNumber[:]...)
-		data = append(data, outputRoot[:]...)
-		data = append(data, p.OutputRoot[:]...)
-		if !crypto.VerifySignature(crypto.FromECDSAPub(&s.signerKey.PublicKey), crypto.Keccak256(data), p.Signature[:64]) {
-			return nil, errors.New("invalid signature")
+		number = p.L2BlockNumber.ToInt()
+		// proposals signed by the previous key are accepted during its overlap period, as
+		// are proposals from trusted peer signers (which are only checked against this
+		// enclave's signing journal)
+		if !s.verifyProposalSignature(version, domain, &signing.Proposal{
+			ConfigHash:     configHash,
+			L1OriginHash:   l1OriginHash,
+			L2BlockNumber:  number,
+			PrevOutputRoot: outputRoot,
+			OutputRoot:     p.OutputRoot,
+		}, p.Signature) {
+			return nil, newError(ErrorCodeInvalidProposal, "signature", fmt.Sprintf("invalid signature for proposal at block %s", number))
 		}
 		outputRoot = p.OutputRoot
 	}
 
-	data := append(configHash[:], l1OriginHash[:]...)
-	data = append(data, l2BlockNumber[:]...)
-	data = append(data, prevOutputRoot[:]...)
-	data = append(data, outputRoot[:]...)
-	sig, err := crypto.Sign(crypto.Keccak256(data), s.signerKey)
+	requestDigest, err := aggregationRequestDigest(configHash, prevOutputRoot, proposals)
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign: %w", err)
+		return nil, wrapError(ErrorCodeInternal, "request_digest", "failed to hash request", err)
 	}
-
-	return &Proposal{
-		OutputRoot:    outputRoot,
-		Signature:     sig,
-		L1OriginHash:  l1OriginHash,
-		L2BlockNumber: (*hexutil.Big)(new(big.Int).SetBytes(l2BlockNumber[:])),
-	}, nil
+	if err = s.journal.record(configHash, number.Uint64(), outputRoot); err != nil {
+		return nil, err
+	}
+	proposal, err := s.signProposal(version, domain, &signing.Proposal{
+		ConfigHash:     configHash,
+		L1OriginHash:   l1OriginHash,
+		L2BlockNumber:  number,
+		PrevOutputRoot: prevOutputRoot,
+		OutputRoot:     outputRoot,
+	}, requestDigest)
+	if err != nil {
+		return nil, wrapError(ErrorCodeInternal, "signature", "failed to sign proposal", err)
+	}
+	return proposal, nil
 }
 
 func OutputRootV0(header *types.Header, storageRoot common.Hash) common.Hash {
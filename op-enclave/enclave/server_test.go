@@ -0,0 +1,136 @@
+package enclave
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/base/op-enclave/op-enclave/signing"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func testSigningDomainConfig() *PerChainConfig {
+	return &PerChainConfig{
+		ChainID:               big.NewInt(8453),
+		BlockTime:             2,
+		MaxSequencerDrift:     600,
+		SeqWindowSize:         3600,
+		ChannelTimeoutBedrock: 300,
+		Hardforks:             activeHardforks(7),
+		SigningDomain: &SigningDomain{
+			L1ChainID:    big.NewInt(1),
+			OutputOracle: common.Address{1},
+		},
+	}
+}
+
+func TestAggregateSigningDomain(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, testPCRs(1))
+	cfg := testSigningDomainConfig()
+	if err := cfg.Check(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	configHash := NewChainConfig(cfg).Hash()
+	version, domain := cfg.Signing()
+	if version != signing.Version1 {
+		t.Fatalf("config with a signing domain is signed with version %d", version)
+	}
+
+	prevOutputRoot := common.Hash{1}
+	var proposals []*Proposal
+	outputRoot := prevOutputRoot
+	for i := int64(1); i <= 2; i++ {
+		p := &signing.Proposal{
+			ConfigHash:     configHash,
+			L1OriginHash:   common.Hash{2},
+			L2BlockNumber:  big.NewInt(i),
+			PrevOutputRoot: outputRoot,
+			OutputRoot:     common.BigToHash(big.NewInt(100 + i)),
+		}
+		proposal, err := s.signProposal(version, domain, p, common.Hash{})
+		if err != nil {
+			t.Fatalf("failed to sign proposal: %v", err)
+		}
+		proposals = append(proposals, proposal)
+		outputRoot = p.OutputRoot
+	}
+
+	if _, err := s.Aggregate(ctx, configHash, prevOutputRoot, proposals, nil); err == nil {
+		t.Fatal("typed data signatures were accepted without the config")
+	}
+	// once the enclave has signed for the config, a single proposal cannot be
+	// aggregated without it either
+	s.recordDomainConfig(configHash)
+	var enclaveErr *Error
+	if _, err := s.Aggregate(ctx, configHash, prevOutputRoot, proposals[:1], nil); !errors.As(err, &enclaveErr) || enclaveErr.Check != "config" {
+		t.Fatalf("aggregate without the config of a config with a signing domain was not rejected: %v", err)
+	}
+	other := testSigningDomainConfig()
+	other.SigningDomain.OutputOracle = common.Address{2}
+	if _, err := s.Aggregate(ctx, configHash, prevOutputRoot, proposals, other); !errors.As(err, &enclaveErr) || enclaveErr.Code != ErrorCodeInputMismatch {
+		t.Fatalf("config with another signing domain was not rejected: %v", err)
+	}
+
+	aggregated, err := s.Aggregate(ctx, configHash, prevOutputRoot, proposals, cfg)
+	if err != nil {
+		t.Fatalf("Aggregate: %v", err)
+	}
+	signer, err := signing.Recover(version, domain, &signing.Proposal{
+		ConfigHash:     configHash,
+		L1OriginHash:   aggregated.L1OriginHash,
+		L2BlockNumber:  aggregated.L2BlockNumber.ToInt(),
+		PrevOutputRoot: prevOutputRoot,
+		OutputRoot:     aggregated.OutputRoot,
+	}, aggregated.Signature)
+	if err != nil {
+		t.Fatalf("failed to recover signer: %v", err)
+	}
+	if expected := crypto.PubkeyToAddress(s.signer.get().PublicKey); signer != expected {
+		t.Fatalf("aggregated proposal signer %s is not the enclave signer %s", signer, expected)
+	}
+}
+
+func TestConfigSigningDomainHash(t *testing.T) {
+	cfg := testSigningDomainConfig()
+	if cfg.Version() != version2 {
+		t.Fatalf("config with a signing domain is version %d", cfg.Version())
+	}
+	other := testSigningDomainConfig()
+	other.SigningDomain.L1ChainID = big.NewInt(11155111)
+	if cfg.Hash() == other.Hash() {
+		t.Fatal("signing domain is not part of the config hash")
+	}
+	other.SigningDomain = nil
+	if other.Version() != version1 || cfg.Hash() == other.Hash() {
+		t.Fatal("config without a signing domain has the same hash")
+	}
+	other.Hardforks = nil
+	other.SigningDomain = cfg.SigningDomain
+	if err := other.Check(); err == nil {
+		t.Fatal("signing domain without a hardfork schedule was accepted")
+	}
+}
+
+func TestAggregateInvalidProposals(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, testPCRs(1))
+	for name, proposals := range map[string][]*Proposal{
+		"nil proposal":     {nil},
+		"nil block number": {{OutputRoot: common.Hash{1}}},
+		"large block number": {{
+			OutputRoot:    common.Hash{1},
+			L2BlockNumber: (*hexutil.Big)(new(big.Int).Lsh(common.Big1, 64)),
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var enclaveErr *Error
+			if _, err := s.Aggregate(ctx, common.Hash{}, common.Hash{}, proposals, nil); !errors.As(err, &enclaveErr) || enclaveErr.Code != ErrorCodeInvalidRequest {
+				t.Fatalf("invalid proposal was not rejected: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package enclave
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Shamir's secret sharing over GF(2^8), applied to each byte of the secret. A share is
+// the evaluations of the byte polynomials at x, followed by x (1 to 255).
+
+const maxShamirShares = 255
+
+// shamirSplit splits the secret into n shares, any threshold of which reconstruct it.
+func shamirSplit(secret []byte, n, threshold int, rand io.Reader) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("empty secret")
+	}
+	if threshold < 1 || threshold > n || n > maxShamirShares {
+		return nil, fmt.Errorf("invalid threshold %d of %d shares", threshold, n)
+	}
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+	coefficients := make([]byte, threshold)
+	for j, b := range secret {
+		coefficients[0] = b
+		if _, err := io.ReadFull(rand, coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("failed to generate coefficients: %w", err)
+		}
+		for i := range shares {
+			shares[i][j] = gfEvaluate(coefficients, byte(i+1))
+		}
+	}
+	for i := range coefficients {
+		coefficients[i] = 0
+	}
+	return shares, nil
+}
+
+// shamirCombine reconstructs the secret from shares with distinct x coordinates. With
+// fewer shares than the threshold, the result is unrelated to the secret.
+func shamirCombine(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares")
+	}
+	size := len(shares[0])
+	if size < 2 {
+		return nil, errors.New("invalid share size")
+	}
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool, len(shares))
+	for i, share := range shares {
+		if len(share) != size {
+			return nil, errors.New("shares have different sizes")
+		}
+		x := share[size-1]
+		if x == 0 || seen[x] {
+			return nil, errors.New("invalid or duplicate share")
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+	secret := make([]byte, size-1)
+	ys := make([]byte, len(shares))
+	for j := range secret {
+		for i, share := range shares {
+			ys[i] = share[j]
+		}
+		secret[j] = gfInterpolateZero(xs, ys)
+	}
+	return secret, nil
+}
+
+// gfEvaluate evaluates the polynomial with the coefficients (lowest degree first) at x.
+func gfEvaluate(coefficients []byte, x byte) byte {
+	var result byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = gfMul(result, x) ^ coefficients[i]
+	}
+	return result
+}
+
+// gfInterpolateZero evaluates the Lagrange interpolation of the points at x = 0.
+func gfInterpolateZero(xs, ys []byte) byte {
+	var result byte
+	for i := range xs {
+		basis := byte(1)
+		for j := range xs {
+			if i != j {
+				// x_j / (x_j - x_i), where subtraction is xor
+				basis = gfMul(basis, gfDiv(xs[j], xs[j]^xs[i]))
+			}
+		}
+		result ^= gfMul(ys[i], basis)
+	}
+	return result
+}
+
+// gfMul multiplies in GF(2^8) with the AES polynomial, in constant time.
+func gfMul(a, b byte) byte {
+	var result byte
+	for i := 0; i < 8; i++ {
+		result ^= byte(subtle.ConstantTimeSelect(int(b&1), int(a), 0))
+		carry := a >> 7
+		a <<= 1
+		a ^= byte(subtle.ConstantTimeSelect(int(carry), 0x1b, 0))
+		b >>= 1
+	}
+	return result
+}
+
+// gfInverse returns a^254 = a^-1 (and 0 for 0).
+func gfInverse(a byte) byte {
+	result := a
+	for i := 0; i < 6; i++ {
+		result = gfMul(result, result)
+		result = gfMul(result, a)
+	}
+	return gfMul(result, result)
+}
+
+func gfDiv(a, b byte) byte {
+	return gfMul(a, gfInverse(b))
+}
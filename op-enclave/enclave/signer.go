@@ -0,0 +1,150 @@
+package enclave
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const defaultSignerKeyOverlap = time.Hour
+
+// SignerKeyOverlapFromEnv reads how long a rotated signer key remains valid for
+// Aggregate from the OP_ENCLAVE_SIGNER_KEY_OVERLAP env var (e.g. "24h").
+func SignerKeyOverlapFromEnv() (time.Duration, error) {
+	overlap := os.Getenv("OP_ENCLAVE_SIGNER_KEY_OVERLAP")
+	if overlap == "" {
+		return defaultSignerKeyOverlap, nil
+	}
+	d, err := time.ParseDuration(overlap)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid OP_ENCLAVE_SIGNER_KEY_OVERLAP: %s", overlap)
+	}
+	return d, nil
+}
+
+// signerKeys holds the signer key, and the previous signer key during the overlap
+// period after a rotation.
+type signerKeys struct {
+	mutex    sync.RWMutex
+	current  *ecdsa.PrivateKey
+	previous *ecdsa.PrivateKey
+	expiry   time.Time
+}
+
+// get returns the key that new proposals are signed with.
+func (k *signerKeys) get() *ecdsa.PrivateKey {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.current
+}
+
+// set replaces the signer key, without an overlap period. Like rotate, it fails while
+// a previous key is still in its overlap period.
+func (k *signerKeys) set(key *ecdsa.PrivateKey) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return k.replaceLocked(key, nil, 0)
+}
+
+// rotate replaces the signer key, keeping the current key active until the overlap
+// period has passed. It fails while a previous key is still in its overlap period, as
+// dropping it would invalidate proposals that are still expected to aggregate.
+func (k *signerKeys) rotate(key *ecdsa.PrivateKey, overlap time.Duration) (*ecdsa.PrivateKey, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	previous := k.current
+	return previous, k.replaceLocked(key, previous, overlap)
+}
+
+// replace makes key the signer key, keeping previous active until the overlap period
+// has passed, without previous ever signing new proposals. Like rotate, it fails while
+// a previous key is still in its overlap period.
+func (k *signerKeys) replace(key *ecdsa.PrivateKey, previous *ecdsa.PrivateKey, overlap time.Duration) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return k.replaceLocked(key, previous, overlap)
+}
+
+func (k *signerKeys) replaceLocked(key *ecdsa.PrivateKey, previous *ecdsa.PrivateKey, overlap time.Duration) error {
+	if k.previous != nil && !time.Now().After(k.expiry) {
+		return fmt.Errorf("previous signer key %s is active until %s",
+			crypto.PubkeyToAddress(k.previous.PublicKey).Hex(), k.expiry.Format(time.RFC3339))
+	}
+	k.current = key
+	k.previous = previous
+	k.expiry = time.Now().Add(overlap)
+	return nil
+}
+
+// previousKey returns the previous signer key and its expiry, or nil if there is no
+// previous key or its overlap period has passed.
+func (k *signerKeys) previousKey() (*ecdsa.PrivateKey, time.Time) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	if k.previous == nil || time.Now().After(k.expiry) {
+		return nil, time.Time{}
+	}
+	return k.previous, k.expiry
+}
+
+// active returns the current signer key, followed by the previous key if it is still
+// in its overlap period.
+func (k *signerKeys) active() []*ecdsa.PrivateKey {
+	keys := []*ecdsa.PrivateKey{k.get()}
+	if previous, _ := k.previousKey(); previous != nil {
+		keys = append(keys, previous)
+	}
+	return keys
+}
+
+// verify returns true if the signature over hash was made by any of the active keys.
+func (k *signerKeys) verify(hash []byte, signature []byte) bool {
+	if len(signature) < crypto.SignatureLength-1 {
+		return false
+	}
+	for _, key := range k.active() {
+		if crypto.VerifySignature(crypto.FromECDSAPub(&key.PublicKey), hash, signature[:crypto.SignatureLength-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// RotateSignerKey generates a new signer key, and returns a signer attestation for its
+// public key (see SignerAttestation). New proposals are signed with the new key, while
+// Aggregate continues to accept proposals signed by the previous key until the overlap
+// period has passed. The key cannot be rotated again until then, so the host cannot
+// cycle through keys to drop a previous key before its overlap period has passed.
+func (s *Server) RotateSignerKey(ctx context.Context) (hexutil.Bytes, error) {
+	key, err := ecdsa.GenerateKey(crypto.S256(), s.attestor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signer key: %w", err)
+	}
+	attestation, err := s.attestor.Attest(crypto.FromECDSAPub(&key.PublicKey), []byte(signerAttestationTag), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attest signer key: %w", err)
+	}
+	previous, err := s.signer.rotate(key, s.signerKeyOverlap)
+	if err != nil {
+		return nil, newError(ErrorCodeUnauthorized, "signer_key_overlap", err.Error())
+	}
+	log.Info("Rotated signer key", "address", crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		"previous", crypto.PubkeyToAddress(previous.PublicKey).Hex(), "overlap", s.signerKeyOverlap)
+	return attestation, nil
+}
+
+func signerAddress(key *ecdsa.PrivateKey) *common.Address {
+	if key == nil {
+		return nil
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	return &address
+}
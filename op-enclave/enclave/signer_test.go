@@ -0,0 +1,61 @@
+package enclave
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRotateSignerKeyOverlap(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, testPCRs(1))
+	s.signerKeyOverlap = time.Hour
+
+	original := s.signer.get()
+	if _, err := s.RotateSignerKey(ctx); err != nil {
+		t.Fatalf("RotateSignerKey: %v", err)
+	}
+	rotated := s.signer.get()
+	if _, err := s.RotateSignerKey(ctx); err == nil {
+		t.Fatal("signer key was rotated during the overlap period")
+	}
+	if previous, _ := s.signer.previousKey(); previous != original || s.signer.get() != rotated {
+		t.Fatal("failed rotation replaced the signer keys")
+	}
+
+	// once the overlap period has passed, the key can be rotated again
+	s.signer.expiry = time.Now().Add(-time.Second)
+	if _, err := s.RotateSignerKey(ctx); err != nil {
+		t.Fatalf("RotateSignerKey after the overlap period: %v", err)
+	}
+	if previous, _ := s.signer.previousKey(); previous != rotated {
+		t.Fatal("previous signer key is not the rotated key")
+	}
+}
+
+func TestSetSignerKeyOverlap(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, testPCRs(1))
+	s.signerKeyOverlap = time.Hour
+	if _, err := s.RotateSignerKey(ctx); err != nil {
+		t.Fatalf("RotateSignerKey: %v", err)
+	}
+	previous, _ := s.signer.previousKey()
+	rotated := s.signer.get()
+
+	// a key transfer, even from the enclave to itself, cannot drop the previous key
+	request, err := s.KeyTransferRequest(ctx, nil)
+	if err != nil {
+		t.Fatalf("KeyTransferRequest: %v", err)
+	}
+	response, err := s.EncryptedSignerKey(ctx, request)
+	if err != nil {
+		t.Fatalf("EncryptedSignerKey: %v", err)
+	}
+	if err = s.SetSignerKey(ctx, response); err == nil {
+		t.Fatal("signer key was set during the overlap period")
+	}
+	if p, _ := s.signer.previousKey(); p != previous || s.signer.get() != rotated {
+		t.Fatal("failed key transfer replaced the signer keys")
+	}
+}
@@ -2,8 +2,6 @@ package enclave
 
 import (
 	"context"
-	"errors"
-	"fmt"
 
 	"github.com/ethereum-optimism/optimism/op-node/rollup"
 	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
@@ -23,6 +21,7 @@ func ExecuteStateless(
 	rollupConfig *rollup.Config,
 	l1Origin *types.Header,
 	l1Receipts types.Receipts,
+	l1OriginChain []*L1Block,
 	previousBlockTxs []hexutil.Bytes,
 	blockHeader *types.Header,
 	sequencedTxs []hexutil.Bytes,
@@ -32,18 +31,17 @@ func ExecuteStateless(
 	l1OriginHash := l1Origin.Hash()
 	computed := types.DeriveSha(l1Receipts, trie.NewStackTrie(nil))
 	if computed != l1Origin.ReceiptHash {
-		return errors.New("invalid receipts")
+		return newMismatchError(ErrorCodeInputMismatch, "l1_receipts", "invalid receipts", l1Origin.ReceiptHash, computed)
 	}
 
 	previousBlockHeader := witness.Headers[0]
 	previousBlockHash := previousBlockHeader.Hash()
 	if blockHeader.ParentHash != previousBlockHash {
-		return errors.New("invalid parent hash")
+		return newMismatchError(ErrorCodeInputMismatch, "parent_hash", "invalid parent hash", blockHeader.ParentHash, previousBlockHash)
 	}
 
-	// block must only contain deposit transactions if it is outside the sequencer drift
-	if len(sequencedTxs) > 0 && blockHeader.Time > l1Origin.Time+maxSequencerDriftFjord {
-		return errors.New("l1 origin is too old")
+	if err := checkSequencerDrift(rollupConfig, l1Origin, blockHeader, len(sequencedTxs)); err != nil {
+		return err
 	}
 
 	unmarshalTxs := func(rlp []hexutil.Bytes) (types.Transactions, error) {
@@ -51,7 +49,7 @@ func ExecuteStateless(
 		for i, tx := range rlp {
 			txs[i] = new(types.Transaction)
 			if err := txs[i].UnmarshalBinary(tx); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal transaction: %w", err)
+				return nil, wrapError(ErrorCodeInvalidRequest, "transactions", "failed to unmarshal transaction", err)
 			}
 		}
 		return txs, nil
@@ -63,7 +61,7 @@ func ExecuteStateless(
 
 	previousTxHash := types.DeriveSha(previousTxs, trie.NewStackTrie(nil))
 	if previousTxHash != previousBlockHeader.TxHash {
-		return errors.New("invalid tx hash")
+		return newMismatchError(ErrorCodeInputMismatch, "tx_hash", "invalid tx hash", previousBlockHeader.TxHash, previousTxHash)
 	}
 
 	previousBlock := types.NewBlockWithHeader(previousBlockHeader).WithBody(types.Body{
@@ -72,22 +70,32 @@ func ExecuteStateless(
 
 	l2Parent, err := derive.L2BlockToBlockRef(rollupConfig, previousBlock)
 	if err != nil {
-		return fmt.Errorf("failed to convert L2 block to block ref: %w", err)
+		return wrapError(ErrorCodeInputMismatch, "l2_parent", "failed to convert L2 block to block ref", err)
 	}
 
-	if l2Parent.L1Origin.Hash != l1OriginHash && l2Parent.L1Origin.Hash != l1Origin.ParentHash {
-		return errors.New("invalid L1 origin")
+	l2Fetcher := NewL2SystemConfigFetcher(rollupConfig, previousBlockHash, previousBlockHeader, previousTxs)
+	if len(l1OriginChain) > 0 {
+		// the L1 origin advanced by more than one block
+		sysConfig, err := l2Fetcher.SystemConfigByL2Hash(ctx, previousBlockHash)
+		if err != nil {
+			return wrapError(ErrorCodeInputMismatch, "l2_parent", "failed to read system config of L2 block", err)
+		}
+		if l2Parent, sysConfig, err = applyL1OriginChain(rollupConfig, l2Parent, sysConfig, l1Origin, l1OriginChain); err != nil {
+			return err
+		}
+		l2Fetcher = newStaticSystemConfigFetcher(previousBlockHash, sysConfig)
+	} else if l2Parent.L1Origin.Hash != l1OriginHash && l2Parent.L1Origin.Hash != l1Origin.ParentHash {
+		return newMismatchError(ErrorCodeInvalidBlock, "l1_origin", "invalid L1 origin", l2Parent.L1Origin.Hash, l1OriginHash)
 	}
 
 	l1Fetcher := NewL1ReceiptsFetcher(l1OriginHash, l1Origin, l1Receipts)
-	l2Fetcher := NewL2SystemConfigFetcher(rollupConfig, previousBlockHash, previousBlockHeader, previousTxs)
 	attributeBuilder := derive.NewFetchingAttributesBuilder(rollupConfig, l1Fetcher, l2Fetcher)
 	payload, err := attributeBuilder.PreparePayloadAttributes(ctx, l2Parent, eth.BlockID{
 		Hash:   l1OriginHash,
 		Number: l1Origin.Number.Uint64(),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to prepare payload attributes: %w", err)
+		return wrapError(ErrorCodeInputMismatch, "payload_attributes", "failed to prepare payload attributes", err)
 	}
 
 	// sequencer cannot include manual deposit transactions; otherwise it could mint funds arbitrarily
@@ -97,14 +105,14 @@ func ExecuteStateless(
 	}
 	for _, tx := range txs {
 		if tx.IsDepositTx() {
-			return errors.New("sequenced txs cannot include deposits")
+			return newError(ErrorCodeInvalidBlock, "sequenced_deposits", "sequenced txs cannot include deposits")
 		}
 	}
 
 	// now add the deposits from L1 (and any from fork upgrades)
 	payloadTxs, err := unmarshalTxs(payload.Transactions)
 	if err != nil {
-		return fmt.Errorf("failed to parse payload transactions: %w", err)
+		return wrapError(ErrorCodeInternal, "payload_attributes", "failed to parse payload transactions", err)
 	}
 	txs = append(payloadTxs, txs...)
 
@@ -116,23 +124,46 @@ func ExecuteStateless(
 	block := types.NewBlockWithHeader(blockHeader).WithBody(types.Body{
 		Transactions: txs,
 	})
+	// core.ExecuteStateless cannot be interrupted, so check for cancellation beforehand
+	if ctx.Err() != nil {
+		return contextError(ctx)
+	}
 	blockHeader.Root, blockHeader.ReceiptHash, err = core.ExecuteStateless(config, block, witness)
 	if err != nil {
-		return fmt.Errorf("failed to execute stateless: %w", err)
+		// the witness is missing state, or the block is invalid
+		return wrapError(ErrorCodeInputMismatch, "execution", "failed to execute stateless", err)
 	}
 	if blockHeader.Root != expectedRoot {
-		return errors.New("invalid state root")
+		return newMismatchError(ErrorCodeInvalidBlock, "state_root", "invalid state root", expectedRoot, blockHeader.Root)
 	}
 	if blockHeader.ReceiptHash != expectedReceiptHash {
-		return errors.New("invalid receipt hash")
+		return newMismatchError(ErrorCodeInvalidBlock, "receipt_hash", "invalid receipt hash", expectedReceiptHash, blockHeader.ReceiptHash)
 	}
 
-	if messageAccount.Address.Cmp(l2ToL1MessagePasserAddress) != 0 {
-		return errors.New("invalid message account address")
-	}
-	if err = messageAccount.Verify(blockHeader.Root); err != nil {
-		return fmt.Errorf("failed to verify message account: %w", err)
+	return verifyMessageAccount(messageAccount, blockHeader.Root, "message_account")
+}
+
+// checkSequencerDrift returns an error if the block contains sequenced transactions but
+// is outside the sequencer drift of its L1 origin, which depends on the active hardforks.
+func checkSequencerDrift(rollupConfig *rollup.Config, l1Origin *types.Header, blockHeader *types.Header, sequencedTxs int) error {
+	maxSequencerDrift := rollup.NewChainSpec(rollupConfig).MaxSequencerDrift(l1Origin.Time)
+	if sequencedTxs > 0 && blockHeader.Time > l1Origin.Time+maxSequencerDrift {
+		return newError(ErrorCodeInvalidBlock, "sequencer_drift", "l1 origin is too old")
 	}
+	return nil
+}
 
+// verifyMessageAccount verifies that account is the L2ToL1MessagePasser account in the
+// state with the given root, which proves its storage hash.
+func verifyMessageAccount(account *eth.AccountResult, stateRoot common.Hash, check string) error {
+	if account == nil {
+		return newError(ErrorCodeInvalidRequest, check, "missing message account")
+	}
+	if account.Address.Cmp(l2ToL1MessagePasserAddress) != 0 {
+		return newError(ErrorCodeInputMismatch, check+"_address", "invalid message account address")
+	}
+	if err := account.Verify(stateRoot); err != nil {
+		return wrapError(ErrorCodeInputMismatch, check, "failed to verify message account", err)
+	}
 	return nil
 }
@@ -0,0 +1,101 @@
+package enclave
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// activeHardforks returns a schedule with the first n hardforks after Bedrock active at
+// genesis, and the rest unscheduled.
+func activeHardforks(n int) *Hardforks {
+	zero := uint64(0)
+	h := new(Hardforks)
+	forks := []**uint64{&h.RegolithTime, &h.CanyonTime, &h.DeltaTime, &h.EcotoneTime,
+		&h.FjordTime, &h.GraniteTime, &h.HoloceneTime, &h.IsthmusTime}
+	for _, fork := range forks[:n] {
+		*fork = &zero
+	}
+	return h
+}
+
+func TestCheckSequencerDrift(t *testing.T) {
+	const l1Time = 1_000_000
+	tests := []struct {
+		fork      string
+		hardforks *Hardforks
+		drift     uint64
+	}{
+		{"bedrock", activeHardforks(0), 600},
+		{"canyon", activeHardforks(2), 600},
+		{"ecotone", activeHardforks(4), 600},
+		{"fjord", activeHardforks(5), 1800},
+		{"granite", activeHardforks(6), 1800},
+		{"holocene", activeHardforks(7), 1800},
+	}
+	for _, tt := range tests {
+		cfg := &PerChainConfig{
+			ChainID:               big.NewInt(1),
+			BlockTime:             2,
+			MaxSequencerDrift:     600,
+			SeqWindowSize:         3600,
+			ChannelTimeoutBedrock: 300,
+			Hardforks:             tt.hardforks,
+		}
+		rollupConfig := cfg.ToRollupConfig()
+		l1Origin := &types.Header{Time: l1Time}
+		for _, offset := range []uint64{tt.drift - 1, tt.drift, tt.drift + 1} {
+			t.Run(fmt.Sprintf("%s/%d", tt.fork, offset), func(t *testing.T) {
+				block := &types.Header{Time: l1Time + offset}
+				err := checkSequencerDrift(rollupConfig, l1Origin, block, 1)
+				if offset <= tt.drift && err != nil {
+					t.Fatalf("block within the sequencer drift was rejected: %v", err)
+				}
+				var enclaveErr *Error
+				if offset > tt.drift && (!errors.As(err, &enclaveErr) || enclaveErr.Check != "sequencer_drift") {
+					t.Fatalf("block outside the sequencer drift was not rejected: %v", err)
+				}
+				// deposit-only blocks are allowed outside the sequencer drift
+				if err = checkSequencerDrift(rollupConfig, l1Origin, block, 0); err != nil {
+					t.Fatalf("deposit-only block was rejected: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestCheckSequencerDriftFjordActivation(t *testing.T) {
+	const fjordTime = 1_000_000
+	hardforks := activeHardforks(4)
+	hardforks.FjordTime = new(uint64)
+	*hardforks.FjordTime = fjordTime
+	cfg := &PerChainConfig{
+		ChainID:               big.NewInt(1),
+		BlockTime:             2,
+		MaxSequencerDrift:     600,
+		SeqWindowSize:         3600,
+		ChannelTimeoutBedrock: 300,
+		Hardforks:             hardforks,
+	}
+	rollupConfig := cfg.ToRollupConfig()
+	// the drift is determined by the L1 origin's timestamp, not the L2 block's
+	tests := []struct {
+		l1Time uint64
+		drift  uint64
+	}{
+		{fjordTime - 1, 600},
+		{fjordTime, 1800},
+	}
+	for _, tt := range tests {
+		l1Origin := &types.Header{Time: tt.l1Time}
+		if err := checkSequencerDrift(rollupConfig, l1Origin, &types.Header{Time: tt.l1Time + tt.drift}, 1); err != nil {
+			t.Fatalf("block at the sequencer drift of L1 origin %d was rejected: %v", tt.l1Time, err)
+		}
+		if err := checkSequencerDrift(rollupConfig, l1Origin, &types.Header{Time: tt.l1Time + tt.drift + 1}, 1); err == nil {
+			t.Fatalf("block outside the sequencer drift of L1 origin %d was not rejected", tt.l1Time)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package enclave
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Status describes the enclave build, keys and usage. The build is identified by PCR0:
+// its version and git commit are not compiled into the enclave, as they would change
+// PCR0 for identical sources, but written to eif.json next to the EIF when it is built.
+type Status struct {
+	PCR0                     hexutil.Bytes     `json:"pcr0"`
+	SignerAddress            common.Address    `json:"signer_address"`
+	PreviousSignerAddress    *common.Address   `json:"previous_signer_address,omitempty"`
+	PreviousSignerExpiry     hexutil.Uint64    `json:"previous_signer_expiry,omitempty"`
+	DecryptionKeyFingerprint common.Hash       `json:"decryption_key_fingerprint"`
+	Local                    bool              `json:"local"`
+	ConfigVersions           []hexutil.Uint64  `json:"config_versions"`
+	Hardforks                []rollup.ForkName `json:"hardforks"`
+	L1Time                   hexutil.Uint64    `json:"l1_time"`
+	Uptime                   hexutil.Uint64    `json:"uptime"`
+	Executions               hexutil.Uint64    `json:"executions"`
+	Aggregations             hexutil.Uint64    `json:"aggregations"`
+	Failures                 hexutil.Uint64    `json:"failures"`
+	InstanceID               common.Hash       `json:"instance_id"`
+	Sequence                 hexutil.Uint64    `json:"sequence"`
+}
+
+type serverCounters struct {
+	start        time.Time
+	executions   atomic.Uint64
+	aggregations atomic.Uint64
+	failures     atomic.Uint64
+}
+
+// record counts a call to an RPC method, and whether it failed. It is intended
+// to be deferred with a pointer to the method's named error result.
+func (c *serverCounters) record(counter *atomic.Uint64, err *error) {
+	counter.Add(1)
+	if *err != nil {
+		c.failures.Add(1)
+	}
+}
+
+// Status returns the enclave's build information, public key identifiers, and counters.
+func (s *Server) Status(ctx context.Context) (*Status, error) {
+	configVersions := make([]hexutil.Uint64, len(supportedConfigVersions))
+	for i, v := range supportedConfigVersions {
+		configVersions[i] = hexutil.Uint64(v)
+	}
+	previous, expiry := s.signer.previousKey()
+	var previousExpiry hexutil.Uint64
+	if previous != nil {
+		previousExpiry = hexutil.Uint64(expiry.Unix())
+	}
+	return &Status{
+		PCR0:                     s.pcr0,
+		SignerAddress:            crypto.PubkeyToAddress(s.signer.get().PublicKey),
+		PreviousSignerAddress:    signerAddress(previous),
+		PreviousSignerExpiry:     previousExpiry,
+		DecryptionKeyFingerprint: crypto.Keccak256Hash(crypto.FromECDSAPub(&s.decryptionKey.PublicKey)),
+		Local:                    s.attestor.Local(),
+		ConfigVersions:           configVersions,
+		Hardforks:                SupportedHardforks(),
+		L1Time:                   hexutil.Uint64(s.clock.l1Time.Load()),
+		Uptime:                   hexutil.Uint64(time.Since(s.counters.start).Seconds()),
+		Executions:               hexutil.Uint64(s.counters.executions.Load()),
+		Aggregations:             hexutil.Uint64(s.counters.aggregations.Load()),
+		Failures:                 hexutil.Uint64(s.counters.failures.Load()),
+		InstanceID:               s.instanceID,
+		Sequence:                 hexutil.Uint64(s.sequence.Load()),
+	}, nil
+}
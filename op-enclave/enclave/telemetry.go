@@ -0,0 +1,144 @@
+package enclave
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/netutil"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Telemetry
+//
+// An enclave has no network or disk, so logs and metrics are served on a separate
+// telemetry listener (a vsock port), for the parent instance to relay. A connection
+// sends a single command line:
+//   - "logs" streams structured (JSON) log records, one per line, until closed.
+//   - "metrics" returns the Prometheus text exposition, and closes the connection.
+const (
+	telemetryLogsCommand    = "logs"
+	telemetryMetricsCommand = "metrics"
+	telemetryCommandTimeout = 10 * time.Second
+	logStreamBuffer         = 1024
+)
+
+// LogStream is an io.Writer that fans out log records to telemetry subscribers. Records
+// are dropped for subscribers that cannot keep up, so logging never blocks.
+type LogStream struct {
+	mutex       sync.Mutex
+	subscribers map[chan []byte]struct{}
+}
+
+func NewLogStream() *LogStream {
+	return &LogStream{
+		subscribers: make(map[chan []byte]struct{}),
+	}
+}
+
+func (l *LogStream) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if len(l.subscribers) == 0 {
+		return len(p), nil
+	}
+	record := make([]byte, len(p))
+	copy(record, p)
+	for ch := range l.subscribers {
+		select {
+		case ch <- record:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+func (l *LogStream) subscribe() chan []byte {
+	ch := make(chan []byte, logStreamBuffer)
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (l *LogStream) unsubscribe(ch chan []byte) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.subscribers, ch)
+}
+
+// ServeTelemetry serves logs and metrics to connections from the listener.
+func ServeTelemetry(l net.Listener, logs *LogStream, gatherer prometheus.Gatherer) error {
+	for {
+		conn, err := l.Accept()
+		if netutil.IsTemporaryError(err) {
+			log.Warn("Telemetry accept error", "err", err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		go serveTelemetryConn(conn, logs, gatherer)
+	}
+}
+
+func serveTelemetryConn(conn net.Conn, logs *LogStream, gatherer prometheus.Gatherer) {
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(telemetryCommandTimeout))
+	command, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	switch strings.TrimSpace(command) {
+	case telemetryLogsCommand:
+		streamLogs(conn, logs)
+	case telemetryMetricsCommand:
+		if err = writeMetrics(conn, gatherer); err != nil {
+			log.Warn("Failed to write metrics", "err", err)
+		}
+	default:
+		_, _ = fmt.Fprintf(conn, "unknown command\n")
+	}
+}
+
+func streamLogs(conn net.Conn, logs *LogStream) {
+	ch := logs.subscribe()
+	defer logs.unsubscribe(ch)
+	// the subscriber never sends after its command, so a read returns when it disconnects
+	closed := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		close(closed)
+	}()
+	for {
+		select {
+		case record := <-ch:
+			if _, err := conn.Write(record); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func writeMetrics(w io.Writer, gatherer prometheus.Gatherer) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	encoder := expfmt.NewEncoder(w, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, family := range families {
+		if err = encoder.Encode(family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
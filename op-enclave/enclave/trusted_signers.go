@@ -0,0 +1,133 @@
+package enclave
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/base/op-enclave/op-enclave/signing"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// signerAttestationTag is the user data of signer key attestations, which distinguishes
+// them from attestations of other keys of the enclave.
+const signerAttestationTag = "op-enclave/signer"
+
+// TrustedSignersFromEnv reads the addresses of peer enclave signers whose proposals
+// can be aggregated from the OP_ENCLAVE_TRUSTED_SIGNERS env var (comma separated).
+func TrustedSignersFromEnv() ([]common.Address, error) {
+	var signers []common.Address
+	if addresses := os.Getenv("OP_ENCLAVE_TRUSTED_SIGNERS"); addresses != "" {
+		for _, item := range strings.Split(addresses, ",") {
+			item = strings.TrimSpace(item)
+			if !common.IsHexAddress(item) {
+				return nil, fmt.Errorf("invalid OP_ENCLAVE_TRUSTED_SIGNERS address: %s", item)
+			}
+			signers = append(signers, common.HexToAddress(item))
+		}
+	}
+	return signers, nil
+}
+
+// trustedSigners is the set of peer enclave signers that Aggregate accepts proposals
+// from, in addition to this enclave's own signer keys.
+type trustedSigners struct {
+	mutex   sync.RWMutex
+	signers map[common.Address]struct{}
+}
+
+func newTrustedSigners(signers []common.Address) *trustedSigners {
+	t := &trustedSigners{
+		signers: make(map[common.Address]struct{}, len(signers)),
+	}
+	for _, signer := range signers {
+		t.signers[signer] = struct{}{}
+	}
+	return t
+}
+
+func (t *trustedSigners) contains(signer common.Address) bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	_, ok := t.signers[signer]
+	return ok
+}
+
+func (t *trustedSigners) add(signer common.Address) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.signers[signer] = struct{}{}
+}
+
+func (t *trustedSigners) remove(signer common.Address) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.signers, signer)
+}
+
+func (t *trustedSigners) list() []common.Address {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	signers := make([]common.Address, 0, len(t.signers))
+	for signer := range t.signers {
+		signers = append(signers, signer)
+	}
+	slices.SortFunc(signers, func(x, y common.Address) int {
+		return x.Cmp(y)
+	})
+	return signers
+}
+
+// verifyProposalSignature returns true if the proposal was signed by one of this
+// enclave's active signer keys, or by a trusted peer signer.
+func (s *Server) verifyProposalSignature(version signing.Version, domain *signing.Domain, p *signing.Proposal, signature []byte) bool {
+	hash, err := signing.Hash(version, domain, p)
+	if err != nil {
+		return false
+	}
+	if s.signer.verify(hash[:], signature) {
+		return true
+	}
+	signer, err := signing.Recover(version, domain, p, signature)
+	if err != nil {
+		return false
+	}
+	return s.trusted.contains(signer)
+}
+
+// AddTrustedSigner trusts the signer key of a peer enclave, using its signer attestation
+// (see SignerAttestation). The attestation is verified using the attestation policy, so
+// the peer must be running an accepted enclave image, and must attest a signer key, so
+// that other keys of the peer (like its decryption key) cannot be trusted as signers.
+func (s *Server) AddTrustedSigner(ctx context.Context, attestation hexutil.Bytes) (common.Address, error) {
+	verification, err := s.verifier.verify(attestation, []byte(signerAttestationTag), nil)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to verify signer attestation: %w", err)
+	}
+	public, err := crypto.UnmarshalPubkey(verification.Document.PublicKey)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	signer := crypto.PubkeyToAddress(*public)
+	s.trusted.add(signer)
+	log.Info("Added trusted signer", "address", signer.Hex())
+	return signer, nil
+}
+
+// RemoveTrustedSigner stops trusting proposals signed by a peer enclave signer.
+func (s *Server) RemoveTrustedSigner(ctx context.Context, signer common.Address) error {
+	s.trusted.remove(signer)
+	log.Info("Removed trusted signer", "address", signer.Hex())
+	return nil
+}
+
+// TrustedSigners returns the peer enclave signers that Aggregate accepts proposals from.
+func (s *Server) TrustedSigners(ctx context.Context) ([]common.Address, error) {
+	return s.trusted.list(), nil
+}
@@ -0,0 +1,34 @@
+package enclave
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestAddTrustedSigner(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, testPCRs(1))
+	peer := newTestServer(t, testPCRs(1))
+
+	decryption, err := peer.DecryptionAttestation(ctx)
+	if err != nil {
+		t.Fatalf("DecryptionAttestation: %v", err)
+	}
+	if _, err = s.AddTrustedSigner(ctx, decryption); err == nil {
+		t.Fatal("decryption key attestation was accepted as a signer attestation")
+	}
+
+	attestation, err := peer.SignerAttestation(ctx)
+	if err != nil {
+		t.Fatalf("SignerAttestation: %v", err)
+	}
+	signer, err := s.AddTrustedSigner(ctx, attestation)
+	if err != nil {
+		t.Fatalf("AddTrustedSigner: %v", err)
+	}
+	if expected := crypto.PubkeyToAddress(peer.signer.get().PublicKey); signer != expected || !s.trusted.contains(signer) {
+		t.Fatalf("trusted signer %s is not the peer signer %s", signer, expected)
+	}
+}
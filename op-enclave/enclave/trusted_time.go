@@ -0,0 +1,78 @@
+package enclave
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Trusted time
+//
+// The enclave's clock is ultimately controlled by the host, which could set it back so
+// that expired certificates or stale attestations verify. The trustedClock keeps a lower
+// bound on the current time: the newest timestamp of the L1 origin headers of signed
+// executions. The enclave cannot check these headers against the L1 chain, as the host
+// could fabricate the block, its witness and its L1 origin, so they are only checked
+// against the L1 chain onchain for proposals that are submitted. The bound is therefore
+// only advanced after a proposal has been signed, and at most maxAhead beyond the
+// enclave's clock, so that a fabricated far-future timestamp can only make attestations
+// look stale until the clock catches up, instead of until a restart.
+//
+// Attestations are verified at max(clock, L1 time), so the host cannot move the
+// verification time back before the newest L1 header the enclave has processed, and an
+// attestation is accepted at most MaxAge before it. Setting the clock forward can only
+// cause valid attestations to be rejected. The bound is kept in memory, so until the
+// first execution after a restart there is no bound, and the clock is used alone unless
+// AttestationPolicy.RequireTrustedTime is set, in which case verification fails.
+type trustedClock struct {
+	// l1Time is the newest L1 header timestamp, in seconds
+	l1Time atomic.Uint64
+	// maxAhead is how far the bound can be advanced beyond the clock
+	maxAhead time.Duration
+}
+
+func newTrustedClock(policy AttestationPolicy) *trustedClock {
+	return &trustedClock{maxAhead: maxAttestationClockSkew + policy.MaxAge}
+}
+
+// observe advances the lower bound to the header's timestamp, if it is newer, capped at
+// maxAhead beyond the clock.
+func (c *trustedClock) observe(header *types.Header) {
+	l1Time := header.Time
+	if limit := uint64(time.Now().Add(c.maxAhead).Unix()); l1Time > limit {
+		log.Warn("L1 header is ahead of the clock, capping L1 time", "l1_time", l1Time, "limit", limit)
+		l1Time = limit
+	}
+	for {
+		current := c.l1Time.Load()
+		if l1Time <= current {
+			return
+		}
+		if c.l1Time.CompareAndSwap(current, l1Time) {
+			return
+		}
+	}
+}
+
+// lowerBound returns the newest observed L1 header time, and false if none was observed.
+func (c *trustedClock) lowerBound() (time.Time, bool) {
+	l1Time := c.l1Time.Load()
+	if l1Time == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(l1Time), 0), true
+}
+
+// now returns the current time, which is never before the lower bound.
+func (c *trustedClock) now() time.Time {
+	now := time.Now()
+	if bound, ok := c.lowerBound(); ok && bound.After(now) {
+		if bound.Sub(now) > maxAttestationClockSkew {
+			log.Warn("Clock is behind L1 time, using L1 time", "clock", now, "l1_time", bound)
+		}
+		return bound
+	}
+	return now
+}
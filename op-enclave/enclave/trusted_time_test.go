@@ -0,0 +1,35 @@
+package enclave
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestTrustedClockObserve(t *testing.T) {
+	clock := newTrustedClock(DefaultAttestationPolicy())
+	if _, ok := clock.lowerBound(); ok {
+		t.Fatal("new clock has a lower bound")
+	}
+
+	past := time.Now().Add(-time.Hour).Unix()
+	clock.observe(&types.Header{Time: uint64(past)})
+	if bound, _ := clock.lowerBound(); bound.Unix() != past {
+		t.Fatalf("lower bound %s is not the observed L1 time", bound)
+	}
+	clock.observe(&types.Header{Time: uint64(past - 1)})
+	if bound, _ := clock.lowerBound(); bound.Unix() != past {
+		t.Fatalf("lower bound moved back to %s", bound)
+	}
+
+	// a fabricated far-future L1 time only advances the bound by maxAhead
+	clock.observe(&types.Header{Time: uint64(time.Now().Add(24 * time.Hour).Unix())})
+	bound, _ := clock.lowerBound()
+	if limit := time.Now().Add(clock.maxAhead); bound.After(limit) {
+		t.Fatalf("lower bound %s is beyond the limit %s", bound, limit)
+	}
+	if bound.Before(time.Now()) {
+		t.Fatalf("lower bound %s was not advanced", bound)
+	}
+}
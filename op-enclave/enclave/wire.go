@@ -0,0 +1,476 @@
+package enclave
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/stateless"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// WireFormat identifies an encoding for the ExecuteStateless and Aggregate payloads.
+type WireFormat string
+
+const (
+	// WireFormatJSON uses the regular JSON-RPC methods, with byte fields encoded as hex.
+	WireFormatJSON WireFormat = "json"
+	// WireFormatRLP uses the binary methods with an uncompressed RLP payload.
+	WireFormatRLP WireFormat = "rlp"
+	// WireFormatRLPSnappy uses the binary methods with a snappy compressed RLP payload.
+	WireFormatRLPSnappy WireFormat = "rlp+snappy"
+	// WireFormatRLPZstd uses the binary methods with a zstd compressed RLP payload.
+	WireFormatRLPZstd WireFormat = "rlp+zstd"
+)
+
+// wireFormatPreference lists the supported formats, most preferred first.
+var wireFormatPreference = []WireFormat{WireFormatRLPZstd, WireFormatRLPSnappy, WireFormatRLP, WireFormatJSON}
+
+// Binary payloads are a version byte and a compression byte, followed by the
+// (optionally compressed) RLP body. The decompressed body is limited to
+// Limits.MaxRequestSize, as a request with the same inputs would be larger in JSON,
+// and the witness is checked against the limits before it is decoded, as it is for
+// JSON requests.
+const (
+	wireVersion1 byte = 1
+
+	wireCompressionNone   byte = 0
+	wireCompressionSnappy byte = 1
+	wireCompressionZstd   byte = 2
+
+	wireHeaderLength = 2
+)
+
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+// SelectWireFormat returns the most preferred format in the supported list,
+// falling back to WireFormatJSON.
+func SelectWireFormat(supported []WireFormat) WireFormat {
+	for _, format := range wireFormatPreference {
+		for _, s := range supported {
+			if s == format {
+				return format
+			}
+		}
+	}
+	return WireFormatJSON
+}
+
+type wireExecuteStateless struct {
+	Config             []byte
+	PrevMessageAccount *wireAccountResult `rlp:"nil"`
+	Blocks             []*wireBlockInput
+}
+
+type wireBlockInput struct {
+	L1Origin         *types.Header
+	L1Receipts       []*types.Receipt
+	PreviousBlockTxs [][]byte
+	BlockHeader      *types.Header
+	SequencedTxs     [][]byte
+	Witness          *wireWitness
+	MessageAccount   *wireAccountResult `rlp:"nil"`
+	L1OriginChain    []*wireL1Block     `rlp:"optional"`
+}
+
+type wireL1Block struct {
+	Header   *types.Header
+	Receipts []*types.Receipt
+}
+
+type wireWitness struct {
+	Headers []*types.Header
+	Codes   [][]byte
+	State   [][]byte
+}
+
+type wireAccountResult struct {
+	AccountProof [][]byte
+	Address      common.Address
+	Balance      *big.Int
+	CodeHash     common.Hash
+	Nonce        uint64
+	StorageHash  common.Hash
+	StorageProof []*wireStorageProof
+}
+
+type wireStorageProof struct {
+	Key   *big.Int
+	Value *big.Int
+	Proof [][]byte
+}
+
+type wireAggregate struct {
+	ConfigHash     common.Hash
+	PrevOutputRoot common.Hash
+	Proposals      []*wireProposal
+	Config         []byte `rlp:"optional"`
+}
+
+type wireProposal struct {
+	OutputRoot    common.Hash
+	Signature     []byte
+	L1OriginHash  common.Hash
+	L2BlockNumber *big.Int
+}
+
+// statelessInput is a BlockInput with an already decoded witness.
+type statelessInput struct {
+	*BlockInput
+	witness *stateless.Witness
+}
+
+// EncodeExecuteStateless encodes the arguments of ExecuteStatelessRange as a binary payload.
+func EncodeExecuteStateless(format WireFormat, cfg *PerChainConfig, prevMessageAccount *eth.AccountResult, blocks []*BlockInput) ([]byte, error) {
+	config, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	payload := &wireExecuteStateless{
+		Config:             config,
+		PrevMessageAccount: toWireAccountResult(prevMessageAccount),
+		Blocks:             make([]*wireBlockInput, len(blocks)),
+	}
+	for i, block := range blocks {
+		if payload.Blocks[i], err = toWireBlockInput(block); err != nil {
+			return nil, err
+		}
+	}
+	return encodeWire(format, payload)
+}
+
+func decodeExecuteStateless(data []byte, limits Limits) (*PerChainConfig, *eth.AccountResult, []*statelessInput, error) {
+	var payload wireExecuteStateless
+	if err := decodeWire(data, &payload, limits.MaxRequestSize); err != nil {
+		return nil, nil, nil, err
+	}
+	// check the witness size before decoding it
+	if err := limits.checkWireWitness(payload.Blocks); err != nil {
+		return nil, nil, nil, err
+	}
+	var cfg PerChainConfig
+	if err := json.Unmarshal(payload.Config, &cfg); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	blocks := make([]*statelessInput, len(payload.Blocks))
+	for i, block := range payload.Blocks {
+		blocks[i] = block.toStatelessInput()
+	}
+	return &cfg, payload.PrevMessageAccount.toAccountResult(), blocks, nil
+}
+
+// EncodeAggregate encodes the arguments of Aggregate as a binary payload. The config
+// is optional, and omitted from the payload if nil.
+func EncodeAggregate(format WireFormat, configHash common.Hash, prevOutputRoot common.Hash, proposals []*Proposal, cfg *PerChainConfig) ([]byte, error) {
+	payload := &wireAggregate{
+		ConfigHash:     configHash,
+		PrevOutputRoot: prevOutputRoot,
+		Proposals:      make([]*wireProposal, len(proposals)),
+	}
+	if cfg != nil {
+		config, err := json.Marshal(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode config: %w", err)
+		}
+		payload.Config = config
+	}
+	for i, p := range proposals {
+		payload.Proposals[i] = &wireProposal{
+			OutputRoot:    p.OutputRoot,
+			Signature:     p.Signature,
+			L1OriginHash:  p.L1OriginHash,
+			L2BlockNumber: p.L2BlockNumber.ToInt(),
+		}
+	}
+	return encodeWire(format, payload)
+}
+
+func decodeAggregate(data []byte, maxBodyLength int) (common.Hash, common.Hash, []*Proposal, *PerChainConfig, error) {
+	var payload wireAggregate
+	if err := decodeWire(data, &payload, maxBodyLength); err != nil {
+		return common.Hash{}, common.Hash{}, nil, nil, err
+	}
+	var cfg *PerChainConfig
+	if len(payload.Config) > 0 {
+		cfg = new(PerChainConfig)
+		if err := json.Unmarshal(payload.Config, cfg); err != nil {
+			return common.Hash{}, common.Hash{}, nil, nil, fmt.Errorf("failed to decode config: %w", err)
+		}
+	}
+	proposals := make([]*Proposal, len(payload.Proposals))
+	for i, p := range payload.Proposals {
+		proposals[i] = &Proposal{
+			OutputRoot:    p.OutputRoot,
+			Signature:     p.Signature,
+			L1OriginHash:  p.L1OriginHash,
+			L2BlockNumber: (*hexutil.Big)(p.L2BlockNumber),
+		}
+	}
+	return payload.ConfigHash, payload.PrevOutputRoot, proposals, cfg, nil
+}
+
+func encodeWire(format WireFormat, payload interface{}) ([]byte, error) {
+	body, err := rlp.EncodeToBytes(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload: %w", err)
+	}
+	header := []byte{wireVersion1, wireCompressionNone}
+	switch format {
+	case WireFormatRLP:
+		return append(header, body...), nil
+	case WireFormatRLPSnappy:
+		header[1] = wireCompressionSnappy
+		return append(header, snappy.Encode(nil, body)...), nil
+	case WireFormatRLPZstd:
+		header[1] = wireCompressionZstd
+		return zstdEncoder.EncodeAll(body, header), nil
+	default:
+		return nil, fmt.Errorf("unsupported binary wire format: %s", format)
+	}
+}
+
+// decodeWire decodes a binary payload whose body, once decompressed, is at most
+// maxBodyLength bytes.
+func decodeWire(data []byte, payload interface{}, maxBodyLength int) error {
+	if len(data) < wireHeaderLength {
+		return errors.New("payload too short")
+	}
+	if data[0] != wireVersion1 {
+		return fmt.Errorf("unsupported payload version: %d", data[0])
+	}
+	body := data[wireHeaderLength:]
+	switch data[1] {
+	case wireCompressionNone:
+		if len(body) > maxBodyLength {
+			return wireBodyTooLarge(maxBodyLength)
+		}
+	case wireCompressionSnappy:
+		length, err := snappy.DecodedLen(body)
+		if err != nil {
+			return fmt.Errorf("failed to decompress payload: %w", err)
+		}
+		if length > maxBodyLength {
+			return wireBodyTooLarge(maxBodyLength)
+		}
+		if body, err = snappy.Decode(nil, body); err != nil {
+			return fmt.Errorf("failed to decompress payload: %w", err)
+		}
+	case wireCompressionZstd:
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(maxBodyLength)))
+		if err != nil {
+			return fmt.Errorf("failed to create decompressor: %w", err)
+		}
+		defer decoder.Close()
+		if body, err = decoder.DecodeAll(body, nil); errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+			return wireBodyTooLarge(maxBodyLength)
+		} else if err != nil {
+			return fmt.Errorf("failed to decompress payload: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported payload compression: %d", data[1])
+	}
+	if err := rlp.DecodeBytes(body, payload); err != nil {
+		return fmt.Errorf("failed to decode payload: %w", err)
+	}
+	return nil
+}
+
+func wireBodyTooLarge(maxBodyLength int) *Error {
+	return newError(ErrorCodeLimitExceeded, "max_request_size",
+		fmt.Sprintf("decompressed payload exceeds %d bytes", maxBodyLength))
+}
+
+// payloadError returns the error for a payload that failed to decode: limit errors are
+// returned as they are, and other errors as invalid requests.
+func payloadError(err error) *Error {
+	var enclaveErr *Error
+	if errors.As(err, &enclaveErr) {
+		return enclaveErr
+	}
+	return wrapError(ErrorCodeInvalidRequest, "payload", "failed to decode payload", err)
+}
+
+func toWireBlockInput(block *BlockInput) (*wireBlockInput, error) {
+	codes, err := decodeHexValues(block.Witness.Codes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode witness codes: %w", err)
+	}
+	state, err := decodeHexValues(block.Witness.State)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode witness state: %w", err)
+	}
+	return &wireBlockInput{
+		L1Origin:         block.L1Origin,
+		L1Receipts:       block.L1Receipts,
+		PreviousBlockTxs: fromHexBytes(block.PreviousBlockTxs),
+		BlockHeader:      block.BlockHeader,
+		SequencedTxs:     fromHexBytes(block.SequencedTxs),
+		Witness: &wireWitness{
+			Headers: block.Witness.Headers,
+			Codes:   codes,
+			State:   state,
+		},
+		MessageAccount: toWireAccountResult(block.MessageAccount),
+		L1OriginChain:  toWireL1Blocks(block.L1OriginChain),
+	}, nil
+}
+
+func toWireL1Blocks(blocks []*L1Block) []*wireL1Block {
+	if len(blocks) == 0 {
+		return nil
+	}
+	out := make([]*wireL1Block, len(blocks))
+	for i, block := range blocks {
+		out[i] = &wireL1Block{
+			Header:   block.Header,
+			Receipts: block.Receipts,
+		}
+	}
+	return out
+}
+
+func toWireAccountResult(account *eth.AccountResult) *wireAccountResult {
+	if account == nil {
+		return nil
+	}
+	storageProof := make([]*wireStorageProof, len(account.StorageProof))
+	for i, entry := range account.StorageProof {
+		storageProof[i] = &wireStorageProof{
+			Key:   entry.Key.ToInt(),
+			Value: entry.Value.ToInt(),
+			Proof: fromHexBytes(entry.Proof),
+		}
+	}
+	return &wireAccountResult{
+		AccountProof: fromHexBytes(account.AccountProof),
+		Address:      account.Address,
+		Balance:      account.Balance.ToInt(),
+		CodeHash:     account.CodeHash,
+		Nonce:        uint64(account.Nonce),
+		StorageHash:  account.StorageHash,
+		StorageProof: storageProof,
+	}
+}
+
+func (a *wireAccountResult) toAccountResult() *eth.AccountResult {
+	if a == nil {
+		return nil
+	}
+	storageProof := make([]eth.StorageProofEntry, len(a.StorageProof))
+	for i, entry := range a.StorageProof {
+		storageProof[i] = eth.StorageProofEntry{
+			Key:   hexutil.Big(*bigOrZero(entry.Key)),
+			Value: hexutil.Big(*bigOrZero(entry.Value)),
+			Proof: toHexBytes(entry.Proof),
+		}
+	}
+	return &eth.AccountResult{
+		AccountProof: toHexBytes(a.AccountProof),
+		Address:      a.Address,
+		Balance:      (*hexutil.Big)(bigOrZero(a.Balance)),
+		CodeHash:     a.CodeHash,
+		Nonce:        hexutil.Uint64(a.Nonce),
+		StorageHash:  a.StorageHash,
+		StorageProof: storageProof,
+	}
+}
+
+// setDerivedReceiptFields sets the fields of receipts decoded from their consensus
+// encoding, which omits the derived fields that the deposit derivation relies on.
+func setDerivedReceiptFields(header *types.Header, receipts []*types.Receipt) {
+	var logIndex uint
+	for i, receipt := range receipts {
+		receipt.BlockHash = header.Hash()
+		receipt.BlockNumber = header.Number
+		receipt.TransactionIndex = uint(i)
+		for _, l := range receipt.Logs {
+			l.BlockHash = receipt.BlockHash
+			l.BlockNumber = header.Number.Uint64()
+			l.TxIndex = uint(i)
+			l.Index = logIndex
+			logIndex++
+		}
+	}
+}
+
+func (w *wireBlockInput) toStatelessInput() *statelessInput {
+	setDerivedReceiptFields(w.L1Origin, w.L1Receipts)
+	var l1OriginChain []*L1Block
+	for _, block := range w.L1OriginChain {
+		if block.Header != nil {
+			setDerivedReceiptFields(block.Header, block.Receipts)
+		}
+		l1OriginChain = append(l1OriginChain, &L1Block{
+			Header:   block.Header,
+			Receipts: block.Receipts,
+		})
+	}
+
+	witness := &stateless.Witness{
+		Headers: w.Witness.Headers,
+		Codes:   toSet(w.Witness.Codes),
+		State:   toSet(w.Witness.State),
+	}
+	return &statelessInput{
+		BlockInput: &BlockInput{
+			L1Origin:         w.L1Origin,
+			L1Receipts:       w.L1Receipts,
+			L1OriginChain:    l1OriginChain,
+			PreviousBlockTxs: toHexBytes(w.PreviousBlockTxs),
+			BlockHeader:      w.BlockHeader,
+			SequencedTxs:     toHexBytes(w.SequencedTxs),
+			MessageAccount:   w.MessageAccount.toAccountResult(),
+		},
+		witness: witness,
+	}
+}
+
+func decodeHexValues(in map[string]string) ([][]byte, error) {
+	out := make([][]byte, 0, len(in))
+	for _, item := range in {
+		value, err := hexutil.Decode(item)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, value)
+	}
+	return out, nil
+}
+
+func toSet(in [][]byte) map[string]struct{} {
+	out := make(map[string]struct{}, len(in))
+	for _, item := range in {
+		out[string(item)] = struct{}{}
+	}
+	return out
+}
+
+func fromHexBytes(in []hexutil.Bytes) [][]byte {
+	out := make([][]byte, len(in))
+	for i, b := range in {
+		out[i] = b
+	}
+	return out
+}
+
+func toHexBytes(in [][]byte) []hexutil.Bytes {
+	out := make([]hexutil.Bytes, len(in))
+	for i, b := range in {
+		out[i] = b
+	}
+	return out
+}
+
+func bigOrZero(i *big.Int) *big.Int {
+	if i == nil {
+		return new(big.Int)
+	}
+	return i
+}
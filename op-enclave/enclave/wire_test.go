@@ -0,0 +1,54 @@
+package enclave
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/stateless"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func testWirePayload(t *testing.T, format WireFormat, stateSize int) []byte {
+	t.Helper()
+	payload, err := EncodeExecuteStateless(format, &PerChainConfig{ChainID: big.NewInt(1)}, nil, []*BlockInput{{
+		L1Origin:    &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(0)},
+		BlockHeader: &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(0)},
+		Witness: &stateless.ExecutionWitness{
+			State: map[string]string{"0": hexutil.Encode(bytes.Repeat([]byte{0}, stateSize))},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("failed to encode payload: %v", err)
+	}
+	return payload
+}
+
+func TestDecodeWireLimits(t *testing.T) {
+	limits := DefaultLimits()
+	limits.MaxRequestSize = 1 << 20
+	limits.MaxWitnessBytes = 1 << 19
+	for _, format := range []WireFormat{WireFormatRLP, WireFormatRLPSnappy, WireFormatRLPZstd} {
+		t.Run(string(format), func(t *testing.T) {
+			if _, _, _, err := decodeExecuteStateless(testWirePayload(t, format, 1<<10), limits); err != nil {
+				t.Fatalf("payload within the limits was rejected: %v", err)
+			}
+			tests := []struct {
+				stateSize int
+				check     string
+			}{
+				{limits.MaxRequestSize + 1, "max_request_size"},
+				{limits.MaxWitnessBytes + 1, "max_witness_bytes"},
+			}
+			for _, tt := range tests {
+				_, _, _, err := decodeExecuteStateless(testWirePayload(t, format, tt.stateSize), limits)
+				var enclaveErr *Error
+				if !errors.As(err, &enclaveErr) || enclaveErr.Code != ErrorCodeLimitExceeded || enclaveErr.Check != tt.check {
+					t.Fatalf("payload exceeding %s was not rejected: %v", tt.check, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+// Package framing implements the length-prefixed framing of JSON-RPC messages on the
+// enclave's vsock stream, between the enclave and the proxy on the parent instance.
+//
+// Each message is preceded by its length, as a 4 byte big-endian unsigned integer, so
+// that message boundaries are known without parsing the message, and oversized
+// messages can be rejected before they are read.
+package framing
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+)
+
+const headerSize = 4
+
+// ErrTooLarge is returned when a frame exceeds the maximum size.
+var ErrTooLarge = errors.New("frame exceeds max size")
+
+// Write writes the payload as a single frame. Concurrent writes must be serialized by
+// the caller.
+func Write(w io.Writer, payload []byte) error {
+	if uint64(len(payload)) > math.MaxUint32 {
+		return ErrTooLarge
+	}
+	var header [headerSize]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+	buffers := net.Buffers{header[:], payload}
+	_, err := buffers.WriteTo(w)
+	return err
+}
+
+// Read reads a frame, and returns its payload. io.EOF is returned if the stream ends
+// between frames. If the frame is larger than maxSize, ErrTooLarge is returned without
+// reading the payload, and the stream can no longer be used.
+func Read(r io.Reader, maxSize int) ([]byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if uint64(size) > uint64(maxSize) {
+		return nil, fmt.Errorf("%w: %d bytes, limit is %d", ErrTooLarge, size, maxSize)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return payload, nil
+}
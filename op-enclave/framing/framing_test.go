@@ -0,0 +1,57 @@
+package framing
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	payloads := [][]byte{[]byte(`{"jsonrpc":"2.0"}`), {}, bytes.Repeat([]byte{1}, 1<<16)}
+	for _, payload := range payloads {
+		if err := Write(&buf, payload); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	for i, expected := range payloads {
+		payload, err := Read(&buf, 1<<16)
+		if err != nil {
+			t.Fatalf("Read frame %d: %v", i, err)
+		}
+		if !bytes.Equal(payload, expected) {
+			t.Fatalf("frame %d does not round trip", i)
+		}
+	}
+	if _, err := Read(&buf, 1<<16); err != io.EOF {
+		t.Fatalf("expected io.EOF between frames, got: %v", err)
+	}
+}
+
+func TestReadTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, make([]byte, 101)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := Read(&buf, 100); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got: %v", err)
+	}
+	// the payload is not read
+	if buf.Len() != 101 {
+		t.Fatalf("oversized payload was read: %d bytes left", buf.Len())
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+	var frame bytes.Buffer
+	if err := Write(&frame, []byte("payload")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	for _, size := range []int{2, headerSize, frame.Len() - 1} {
+		_, err := Read(bytes.NewReader(frame.Bytes()[:size]), 100)
+		if err != io.ErrUnexpectedEOF {
+			t.Fatalf("expected io.ErrUnexpectedEOF for a frame truncated to %d bytes, got: %v", size, err)
+		}
+	}
+}
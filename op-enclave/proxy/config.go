@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultCID             = 16
+	defaultRPCPort         = 1234
+	defaultRATLSPort       = 1235
+	defaultTelemetryPort   = 1236
+	defaultRPCAddr         = ":7333"
+	defaultRATLSAddr       = ":7334"
+	defaultMetricsAddr     = ":7300"
+	defaultMaxRequestSize  = 256 << 20
+	defaultMaxResponseSize = 64 << 20
+	// the enclave's default execution timeout is 5 minutes, so that its own timeout
+	// error is returned before the proxy's deadline
+	defaultRequestTimeout   = 6 * time.Minute
+	defaultReadyTimeout     = 5 * time.Second
+	defaultDialTimeout      = 5 * time.Second
+	defaultMaxIdleConns     = 8
+	defaultIdleTimeout      = time.Minute
+	defaultShutdownTimeout  = time.Minute
+	defaultLogRetryInterval = 5 * time.Second
+)
+
+// Config configures the proxy between the parent instance and the enclave.
+type Config struct {
+	// CID is the vsock context ID of the enclave.
+	CID uint32
+	// RPCPort is the enclave's vsock port for framed JSON-RPC.
+	RPCPort uint32
+	// RATLSPort is the enclave's vsock port for RA-TLS.
+	RATLSPort uint32
+	// TelemetryPort is the enclave's vsock port for logs and metrics.
+	TelemetryPort uint32
+
+	// RPCAddr is the HTTP listen address for JSON-RPC, health and readiness.
+	RPCAddr string
+	// RATLSAddr is the TCP listen address that is passed through to the RA-TLS port.
+	RATLSAddr string
+	// MetricsAddr is the HTTP listen address for the proxy's and enclave's metrics.
+	MetricsAddr string
+
+	// MaxRequestSize is the maximum size of a JSON-RPC request body in bytes.
+	MaxRequestSize int
+	// MaxResponseSize is the maximum size of a JSON-RPC response from the enclave.
+	MaxResponseSize int
+	// RequestTimeout is the deadline for each JSON-RPC request.
+	RequestTimeout time.Duration
+	// ReadyTimeout is the deadline for the readiness check.
+	ReadyTimeout time.Duration
+	// DialTimeout is the deadline for opening a vsock connection.
+	DialTimeout time.Duration
+	// MaxIdleConns is the maximum number of idle vsock connections kept for reuse.
+	MaxIdleConns int
+	// IdleTimeout is the duration after which idle vsock connections are closed.
+	IdleTimeout time.Duration
+	// ShutdownTimeout is the time given to in-flight requests on shutdown.
+	ShutdownTimeout time.Duration
+}
+
+// DefaultConfig returns the config used when none is set.
+func DefaultConfig() Config {
+	return Config{
+		CID:             defaultCID,
+		RPCPort:         defaultRPCPort,
+		RATLSPort:       defaultRATLSPort,
+		TelemetryPort:   defaultTelemetryPort,
+		RPCAddr:         defaultRPCAddr,
+		RATLSAddr:       defaultRATLSAddr,
+		MetricsAddr:     defaultMetricsAddr,
+		MaxRequestSize:  defaultMaxRequestSize,
+		MaxResponseSize: defaultMaxResponseSize,
+		RequestTimeout:  defaultRequestTimeout,
+		ReadyTimeout:    defaultReadyTimeout,
+		DialTimeout:     defaultDialTimeout,
+		MaxIdleConns:    defaultMaxIdleConns,
+		IdleTimeout:     defaultIdleTimeout,
+		ShutdownTimeout: defaultShutdownTimeout,
+	}
+}
+
+// ConfigFromEnv reads the config from OP_ENCLAVE_PROXY_* env vars, using the defaults
+// for unset vars.
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+	for name, value := range map[string]*uint32{
+		"OP_ENCLAVE_PROXY_CID":            &cfg.CID,
+		"OP_ENCLAVE_PROXY_RPC_PORT":       &cfg.RPCPort,
+		"OP_ENCLAVE_PROXY_RATLS_PORT":     &cfg.RATLSPort,
+		"OP_ENCLAVE_PROXY_TELEMETRY_PORT": &cfg.TelemetryPort,
+	} {
+		if env := os.Getenv(name); env != "" {
+			n, err := strconv.ParseUint(env, 10, 32)
+			if err != nil {
+				return Config{}, fmt.Errorf("invalid %s: %s", name, env)
+			}
+			*value = uint32(n)
+		}
+	}
+	for name, value := range map[string]*string{
+		"OP_ENCLAVE_PROXY_RPC_ADDR":     &cfg.RPCAddr,
+		"OP_ENCLAVE_PROXY_RATLS_ADDR":   &cfg.RATLSAddr,
+		"OP_ENCLAVE_PROXY_METRICS_ADDR": &cfg.MetricsAddr,
+	} {
+		if env := os.Getenv(name); env != "" {
+			*value = env
+		}
+	}
+	for name, value := range map[string]*int{
+		"OP_ENCLAVE_PROXY_MAX_REQUEST_SIZE":  &cfg.MaxRequestSize,
+		"OP_ENCLAVE_PROXY_MAX_RESPONSE_SIZE": &cfg.MaxResponseSize,
+		"OP_ENCLAVE_PROXY_MAX_IDLE_CONNS":    &cfg.MaxIdleConns,
+	} {
+		if env := os.Getenv(name); env != "" {
+			n, err := strconv.ParseUint(env, 10, 31)
+			if err != nil || n == 0 {
+				return Config{}, fmt.Errorf("invalid %s: %s", name, env)
+			}
+			*value = int(n)
+		}
+	}
+	for name, value := range map[string]*time.Duration{
+		"OP_ENCLAVE_PROXY_REQUEST_TIMEOUT":  &cfg.RequestTimeout,
+		"OP_ENCLAVE_PROXY_READY_TIMEOUT":    &cfg.ReadyTimeout,
+		"OP_ENCLAVE_PROXY_DIAL_TIMEOUT":     &cfg.DialTimeout,
+		"OP_ENCLAVE_PROXY_IDLE_TIMEOUT":     &cfg.IdleTimeout,
+		"OP_ENCLAVE_PROXY_SHUTDOWN_TIMEOUT": &cfg.ShutdownTimeout,
+	} {
+		if env := os.Getenv(name); env != "" {
+			d, err := time.ParseDuration(env)
+			if err != nil || d <= 0 {
+				return Config{}, fmt.Errorf("invalid %s: %s", name, env)
+			}
+			*value = d
+		}
+	}
+	return cfg, nil
+}
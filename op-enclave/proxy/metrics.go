@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const metricsNamespace = "op_enclave_proxy"
+
+// proxyMetrics are the Prometheus metrics of the Proxy.
+type proxyMetrics struct {
+	requests        *prometheus.CounterVec
+	requestDuration prometheus.Histogram
+	requestBytes    prometheus.Histogram
+	responseBytes   prometheus.Histogram
+	inFlight        prometheus.Gauge
+	dials           *prometheus.CounterVec
+	ready           prometheus.Gauge
+}
+
+// newProxyMetrics registers the metrics with registerer. If it is nil, the metrics are
+// not exported.
+func newProxyMetrics(registerer prometheus.Registerer) *proxyMetrics {
+	if registerer == nil {
+		registerer = prometheus.NewRegistry()
+	}
+	m := &proxyMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_total",
+			Help:      "Number of JSON-RPC requests, by HTTP status code",
+		}, []string{"code"}),
+		requestDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_duration_seconds",
+			Help:      "Duration of JSON-RPC requests",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 16),
+		}),
+		requestBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_bytes",
+			Help:      "Size of JSON-RPC requests",
+			Buckets:   prometheus.ExponentialBuckets(256, 4, 10),
+		}),
+		responseBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "response_bytes",
+			Help:      "Size of JSON-RPC responses",
+			Buckets:   prometheus.ExponentialBuckets(256, 4, 8),
+		}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_in_flight",
+			Help:      "Number of JSON-RPC requests in progress",
+		}),
+		dials: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "vsock_dials_total",
+			Help:      "Number of vsock connections opened to the enclave's RPC port, by result",
+		}, []string{"result"}),
+		ready: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "enclave_ready",
+			Help:      "Whether the last readiness check of the enclave succeeded",
+		}),
+	}
+	registerer.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.requestBytes,
+		m.responseBytes,
+		m.inFlight,
+		m.dials,
+		m.ready,
+	)
+	return m
+}
+
+// recordRequest records a request that started at start. It is intended to be deferred
+// with a pointer to the handler's status code.
+func (m *proxyMetrics) recordRequest(start time.Time, code *int) {
+	m.requests.WithLabelValues(strconv.Itoa(*code)).Inc()
+	m.requestDuration.Observe(time.Since(start).Seconds())
+	m.inFlight.Dec()
+}
+
+func (m *proxyMetrics) recordDial(err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.dials.WithLabelValues(result).Inc()
+}
+
+func (m *proxyMetrics) recordReady(err error) {
+	if err != nil {
+		m.ready.Set(0)
+	} else {
+		m.ready.Set(1)
+	}
+}
+
+// enclaveGatherer gathers the enclave's metrics from its telemetry port (see
+// enclave.ServeTelemetry).
+type enclaveGatherer struct {
+	dial    func(ctx context.Context) (net.Conn, error)
+	timeout time.Duration
+}
+
+func (g *enclaveGatherer) Gather() ([]*dto.MetricFamily, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), g.timeout)
+	defer cancel()
+	conn, err := g.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial enclave telemetry: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if _, err = conn.Write([]byte(telemetryMetricsCommand + "\n")); err != nil {
+		return nil, fmt.Errorf("failed to request enclave metrics: %w", err)
+	}
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bufio.NewReader(conn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse enclave metrics: %w", err)
+	}
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]*dto.MetricFamily, len(names))
+	for i, name := range names {
+		result[i] = families[name]
+	}
+	return result, nil
+}
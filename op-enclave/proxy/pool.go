@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/vsock"
+)
+
+// healthCheckTimeout is how long a pooled connection is read from to detect that it
+// was closed by the enclave, e.g. after a restart.
+const healthCheckTimeout = time.Millisecond
+
+var errPoolClosed = errors.New("connection pool closed")
+
+// Dialer opens a connection to a port of the enclave.
+type Dialer func(ctx context.Context, port uint32) (net.Conn, error)
+
+// VsockDialer returns a Dialer for the enclave with the vsock context ID.
+func VsockDialer(cid uint32) Dialer {
+	return func(ctx context.Context, port uint32) (net.Conn, error) {
+		type result struct {
+			conn net.Conn
+			err  error
+		}
+		// vsock.Dial has no timeout, so it is abandoned (and its connection closed) if
+		// ctx is done first
+		done := make(chan result, 1)
+		go func() {
+			conn, err := vsock.Dial(cid, port, &vsock.Config{})
+			done <- result{conn, err}
+		}()
+		select {
+		case r := <-done:
+			return r.conn, r.err
+		case <-ctx.Done():
+			go func() {
+				if r := <-done; r.err == nil {
+					_ = r.conn.Close()
+				}
+			}()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+type idleConn struct {
+	net.Conn
+	since time.Time
+}
+
+// connPool keeps idle connections to the enclave's RPC port for reuse. Connections are
+// checked before reuse, and closed if they expired or were closed by the enclave.
+type connPool struct {
+	dial        func(ctx context.Context) (net.Conn, error)
+	idleTimeout time.Duration
+
+	mutex  sync.Mutex
+	idle   []idleConn
+	max    int
+	closed bool
+}
+
+func newConnPool(dial func(ctx context.Context) (net.Conn, error), maxIdle int, idleTimeout time.Duration) *connPool {
+	return &connPool{
+		dial:        dial,
+		idleTimeout: idleTimeout,
+		max:         maxIdle,
+	}
+}
+
+// get returns a healthy idle connection, or dials a new one. reused reports whether
+// the connection was idle.
+func (p *connPool) get(ctx context.Context) (conn net.Conn, reused bool, err error) {
+	for {
+		c, ok, err := p.pop()
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			break
+		}
+		if time.Since(c.since) < p.idleTimeout && healthy(c.Conn) {
+			return c.Conn, true, nil
+		}
+		_ = c.Close()
+	}
+	conn, err = p.dial(ctx)
+	return conn, false, err
+}
+
+func (p *connPool) pop() (idleConn, bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return idleConn{}, false, errPoolClosed
+	}
+	if len(p.idle) == 0 {
+		return idleConn{}, false, nil
+	}
+	// most recently used first, so that the oldest connections expire
+	c := p.idle[len(p.idle)-1]
+	p.idle = p.idle[:len(p.idle)-1]
+	return c, true, nil
+}
+
+// put returns a connection that completed a request to the pool.
+func (p *connPool) put(conn net.Conn) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed || len(p.idle) >= p.max {
+		_ = conn.Close()
+		return
+	}
+	p.idle = append(p.idle, idleConn{Conn: conn, since: time.Now()})
+}
+
+func (p *connPool) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.closed = true
+	for _, c := range p.idle {
+		_ = c.Close()
+	}
+	p.idle = nil
+}
+
+// healthy returns true if the idle connection is still open, and has no unexpected
+// data to read.
+func healthy(conn net.Conn) bool {
+	if err := conn.SetReadDeadline(time.Now().Add(healthCheckTimeout)); err != nil {
+		return false
+	}
+	var b [1]byte
+	_, err := conn.Read(b[:])
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// pipeDialer dials in-memory connections, keeping the enclave side of each.
+type pipeDialer struct {
+	remotes []net.Conn
+}
+
+func (d *pipeDialer) dial(ctx context.Context) (net.Conn, error) {
+	local, remote := net.Pipe()
+	d.remotes = append(d.remotes, remote)
+	return local, nil
+}
+
+// isClosed returns true if either side of the pipe was closed.
+func isClosed(conn net.Conn) bool {
+	return conn.SetDeadline(time.Time{}) != nil
+}
+
+func TestConnPoolReuse(t *testing.T) {
+	ctx := context.Background()
+	d := new(pipeDialer)
+	pool := newConnPool(d.dial, 2, time.Minute)
+	defer pool.close()
+
+	conn, reused, err := pool.get(ctx)
+	if err != nil || reused {
+		t.Fatalf("first connection was not dialed: %v", err)
+	}
+	pool.put(conn)
+	again, reused, err := pool.get(ctx)
+	if err != nil || !reused || again != conn {
+		t.Fatalf("idle connection was not reused: %v", err)
+	}
+	if len(d.remotes) != 1 {
+		t.Fatalf("dialed %d connections", len(d.remotes))
+	}
+}
+
+func TestConnPoolEviction(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("max idle", func(t *testing.T) {
+		d := new(pipeDialer)
+		pool := newConnPool(d.dial, 1, time.Minute)
+		defer pool.close()
+		first, _, _ := pool.get(ctx)
+		second, _, _ := pool.get(ctx)
+		pool.put(first)
+		pool.put(second)
+		if isClosed(first) || !isClosed(second) {
+			t.Fatal("connection beyond the idle limit was not closed")
+		}
+	})
+
+	t.Run("idle timeout", func(t *testing.T) {
+		d := new(pipeDialer)
+		pool := newConnPool(d.dial, 1, time.Millisecond)
+		defer pool.close()
+		conn, _, _ := pool.get(ctx)
+		pool.put(conn)
+		time.Sleep(2 * time.Millisecond)
+		if _, reused, err := pool.get(ctx); err != nil || reused {
+			t.Fatalf("expired connection was reused: %v", err)
+		}
+		if !isClosed(conn) {
+			t.Fatal("expired connection was not closed")
+		}
+	})
+
+	t.Run("closed by enclave", func(t *testing.T) {
+		d := new(pipeDialer)
+		pool := newConnPool(d.dial, 1, time.Minute)
+		defer pool.close()
+		conn, _, _ := pool.get(ctx)
+		pool.put(conn)
+		_ = d.remotes[0].Close()
+		if _, reused, err := pool.get(ctx); err != nil || reused {
+			t.Fatalf("connection closed by the enclave was reused: %v", err)
+		}
+		if len(d.remotes) != 2 {
+			t.Fatalf("dialed %d connections", len(d.remotes))
+		}
+	})
+
+	t.Run("closed pool", func(t *testing.T) {
+		d := new(pipeDialer)
+		pool := newConnPool(d.dial, 1, time.Minute)
+		conn, _, _ := pool.get(ctx)
+		pool.put(conn)
+		pool.close()
+		if !isClosed(conn) {
+			t.Fatal("idle connection was not closed with the pool")
+		}
+		if _, _, err := pool.get(ctx); err != errPoolClosed {
+			t.Fatalf("closed pool returned a connection: %v", err)
+		}
+	})
+}
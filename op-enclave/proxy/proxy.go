@@ -0,0 +1,241 @@
+// Package proxy implements the HTTP proxy on the parent instance, which forwards
+// JSON-RPC requests to the enclave over vsock, and relays its RA-TLS endpoint, logs and
+// metrics.
+//
+// Requests are sent over pooled vsock connections using length-prefixed framing (see
+// package framing), one request at a time per connection. Idle connections are checked
+// before reuse, and a request that fails to be written to a reused connection is
+// retried once on a new connection, as the enclave may have restarted.
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/base/op-enclave/op-enclave/framing"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// readyRequest is sent to the enclave by the readiness check.
+var readyRequest = []byte(`{"jsonrpc":"2.0","id":1,"method":"enclave_status","params":[]}`)
+
+type writeError struct {
+	err error
+}
+
+func (e *writeError) Error() string {
+	return fmt.Sprintf("failed to write request: %v", e.err)
+}
+
+func (e *writeError) Unwrap() error {
+	return e.err
+}
+
+type Proxy struct {
+	cfg      Config
+	dial     Dialer
+	pool     *connPool
+	metrics  *proxyMetrics
+	gatherer prometheus.Gatherer
+}
+
+// New returns a Proxy that connects to the enclave using dial. Its metrics are
+// registered with registry, which is also served by MetricsHandler.
+func New(cfg Config, dial Dialer, registry *prometheus.Registry) *Proxy {
+	if registry == nil {
+		registry = prometheus.NewRegistry()
+	}
+	p := &Proxy{
+		cfg:     cfg,
+		dial:    dial,
+		metrics: newProxyMetrics(registry),
+	}
+	p.pool = newConnPool(p.dialRPC, cfg.MaxIdleConns, cfg.IdleTimeout)
+	p.gatherer = prometheus.Gatherers{registry, &enclaveGatherer{
+		dial: func(ctx context.Context) (net.Conn, error) {
+			return p.dial(ctx, p.cfg.TelemetryPort)
+		},
+		timeout: cfg.ReadyTimeout,
+	}}
+	return p
+}
+
+// Handler returns the HTTP handler that forwards JSON-RPC POST requests, and serves
+// /healthz (the proxy is running) and /readyz (the enclave is responding).
+func (p *Proxy) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", p.serveRPC)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok\n")
+	})
+	mux.HandleFunc("/readyz", p.serveReady)
+	return mux
+}
+
+// MetricsHandler returns the HTTP handler that serves the proxy's and the enclave's
+// metrics. The proxy's metrics are served if the enclave is unavailable.
+func (p *Proxy) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(p.gatherer, promhttp.HandlerOpts{
+		ErrorLog:      promErrorLog{},
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
+
+// Close closes the idle connections to the enclave.
+func (p *Proxy) Close() {
+	p.pool.close()
+}
+
+func (p *Proxy) serveRPC(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	code := http.StatusOK
+	p.metrics.inFlight.Inc()
+	defer p.metrics.recordRequest(start, &code)
+
+	if r.Method != http.MethodPost {
+		code = http.StatusMethodNotAllowed
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", code)
+		return
+	}
+	request, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(p.cfg.MaxRequestSize)))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			code = http.StatusRequestEntityTooLarge
+		} else {
+			code = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	p.metrics.requestBytes.Observe(float64(len(request)))
+
+	ctx, cancel := context.WithTimeout(r.Context(), p.cfg.RequestTimeout)
+	defer cancel()
+	response, err := p.roundTrip(ctx, request)
+	if err != nil {
+		code = http.StatusBadGateway
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			code = http.StatusGatewayTimeout
+		}
+		log.Warn("Error forwarding request to enclave", "err", err, "code", code)
+		http.Error(w, "enclave unavailable", code)
+		return
+	}
+	p.metrics.responseBytes.Observe(float64(len(response)))
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(response)
+}
+
+func (p *Proxy) serveReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), p.cfg.ReadyTimeout)
+	defer cancel()
+	err := p.ping(ctx)
+	p.metrics.recordReady(err)
+	if err != nil {
+		log.Warn("Enclave is not ready", "err", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	_, _ = io.WriteString(w, "ok\n")
+}
+
+// ping sends a status request to the enclave, and checks that it succeeds.
+func (p *Proxy) ping(ctx context.Context) error {
+	response, err := p.roundTrip(ctx, readyRequest)
+	if err != nil {
+		return err
+	}
+	var message struct {
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err = json.Unmarshal(response, &message); err != nil {
+		return fmt.Errorf("invalid status response: %w", err)
+	}
+	if message.Error != nil {
+		return fmt.Errorf("status request failed: %s (%d)", message.Error.Message, message.Error.Code)
+	}
+	return nil
+}
+
+// roundTrip sends a request to the enclave, and returns its response.
+func (p *Proxy) roundTrip(ctx context.Context, request []byte) ([]byte, error) {
+	conn, reused, err := p.pool.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	response, err := p.exchange(ctx, conn, request)
+	var writeErr *writeError
+	if reused && errors.As(err, &writeErr) && ctx.Err() == nil {
+		log.Info("Reconnecting to enclave", "err", err)
+		if conn, err = p.pool.dial(ctx); err != nil {
+			return nil, err
+		}
+		response, err = p.exchange(ctx, conn, request)
+	}
+	return response, err
+}
+
+// exchange writes the request to the connection, and reads the response. The
+// connection is returned to the pool if the exchange succeeds, and closed otherwise.
+func (p *Proxy) exchange(ctx context.Context, conn net.Conn, request []byte) ([]byte, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(p.cfg.RequestTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	// interrupt the exchange if the client goes away
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	if err := framing.Write(conn, request); err != nil {
+		_ = conn.Close()
+		return nil, &writeError{err}
+	}
+	response, err := framing.Read(conn, p.cfg.MaxResponseSize)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if !stop() || conn.SetDeadline(time.Time{}) != nil {
+		_ = conn.Close()
+	} else {
+		p.pool.put(conn)
+	}
+	return response, nil
+}
+
+func (p *Proxy) dialRPC(ctx context.Context) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.DialTimeout)
+	defer cancel()
+	conn, err := p.dial(ctx, p.cfg.RPCPort)
+	p.metrics.recordDial(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial enclave: %w", err)
+	}
+	return conn, nil
+}
+
+// promErrorLog logs errors gathering metrics, e.g. if the enclave is unavailable.
+type promErrorLog struct{}
+
+func (promErrorLog) Println(v ...interface{}) {
+	log.Warn("Error gathering metrics", "err", fmt.Sprint(v...))
+}
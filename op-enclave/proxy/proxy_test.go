@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/base/op-enclave/op-enclave/framing"
+)
+
+// testEnclave echoes framed requests on TCP connections.
+type testEnclave struct {
+	listener net.Listener
+	accepted atomic.Int32
+
+	mutex sync.Mutex
+	conns []net.Conn
+}
+
+func newTestEnclave(t *testing.T) *testEnclave {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &testEnclave{listener: listener}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			e.accepted.Add(1)
+			e.mutex.Lock()
+			e.conns = append(e.conns, conn)
+			e.mutex.Unlock()
+			go func() {
+				defer conn.Close()
+				for {
+					request, err := framing.Read(conn, 1<<20)
+					if err != nil {
+						return
+					}
+					if err = framing.Write(conn, request); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return e
+}
+
+// stop closes the listener and all connections, as if the enclave stopped.
+func (e *testEnclave) stop() {
+	_ = e.listener.Close()
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for _, conn := range e.conns {
+		_ = conn.Close()
+	}
+}
+
+// failingConn fails writes once failWrites is set, while reads are unaffected, so that
+// it passes the pool's health check.
+type failingConn struct {
+	net.Conn
+	failWrites atomic.Bool
+}
+
+func (c *failingConn) Write(b []byte) (int, error) {
+	if c.failWrites.Load() {
+		return 0, errors.New("connection reset")
+	}
+	return c.Conn.Write(b)
+}
+
+func newTestProxy(t *testing.T, e *testEnclave) (*Proxy, *[]*failingConn) {
+	t.Helper()
+	var mutex sync.Mutex
+	var conns []*failingConn
+	dial := func(ctx context.Context, port uint32) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", e.listener.Addr().String())
+		if err != nil {
+			return nil, err
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		c := &failingConn{Conn: conn}
+		conns = append(conns, c)
+		return c, nil
+	}
+	cfg := DefaultConfig()
+	cfg.MaxRequestSize = 1 << 10
+	p := New(cfg, dial, nil)
+	t.Cleanup(p.Close)
+	return p, &conns
+}
+
+func TestProxyReusesConnections(t *testing.T) {
+	e := newTestEnclave(t)
+	p, _ := newTestProxy(t, e)
+	for i := 0; i < 3; i++ {
+		request := []byte(fmt.Sprintf(`{"id":%d}`, i))
+		response, err := p.roundTrip(context.Background(), request)
+		if err != nil {
+			t.Fatalf("roundTrip: %v", err)
+		}
+		if !bytes.Equal(response, request) {
+			t.Fatalf("unexpected response: %s", response)
+		}
+	}
+	if accepted := e.accepted.Load(); accepted != 1 {
+		t.Fatalf("sequential requests used %d connections", accepted)
+	}
+}
+
+func TestProxyRetriesDeadConnection(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEnclave(t)
+	p, conns := newTestProxy(t, e)
+	if _, err := p.roundTrip(ctx, []byte(`{}`)); err != nil {
+		t.Fatalf("roundTrip: %v", err)
+	}
+
+	// the pooled connection passes the health check, but fails on write, as if the
+	// enclave restarted
+	(*conns)[0].failWrites.Store(true)
+	response, err := p.roundTrip(ctx, []byte(`{"retried":true}`))
+	if err != nil {
+		t.Fatalf("request was not retried on a new connection: %v", err)
+	}
+	if string(response) != `{"retried":true}` {
+		t.Fatalf("unexpected response: %s", response)
+	}
+	if len(*conns) != 2 {
+		t.Fatalf("dialed %d connections", len(*conns))
+	}
+}
+
+func TestProxyHandler(t *testing.T) {
+	e := newTestEnclave(t)
+	p, _ := newTestProxy(t, e)
+	server := httptest.NewServer(p.Handler())
+	defer server.Close()
+
+	request := `{"jsonrpc":"2.0","id":1,"method":"enclave_status","params":[]}`
+	res, err := http.Post(server.URL, "application/json", strings.NewReader(request))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("request failed with status %d", res.StatusCode)
+	}
+
+	res, err = http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("GET request returned status %d", res.StatusCode)
+	}
+
+	res, err = http.Post(server.URL, "application/json", bytes.NewReader(make([]byte, p.cfg.MaxRequestSize+1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized request returned status %d", res.StatusCode)
+	}
+
+	res, err = http.Get(server.URL + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("readiness check returned status %d", res.StatusCode)
+	}
+
+	// the pooled connection is discarded, and the enclave cannot be dialed
+	e.stop()
+	res, err = http.Get(server.URL + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("readiness check of an unavailable enclave returned status %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// commands of the enclave's telemetry port (see enclave.ServeTelemetry)
+const (
+	telemetryLogsCommand    = "logs"
+	telemetryMetricsCommand = "metrics"
+)
+
+// closeWriter is implemented by connections that can be half-closed.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// Passthrough forwards TCP connections from the listener to the enclave's RA-TLS port
+// without terminating them, as TLS is terminated inside the enclave. It returns when
+// the listener is closed.
+func (p *Proxy) Passthrough(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		} else if err != nil {
+			log.Warn("Passthrough accept error", "err", err)
+			continue
+		}
+		go p.passthrough(conn)
+	}
+}
+
+func (p *Proxy) passthrough(conn net.Conn) {
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.DialTimeout)
+	upstream, err := p.dial(ctx, p.cfg.RATLSPort)
+	cancel()
+	if err != nil {
+		log.Warn("Error dialing enclave RA-TLS port", "err", err)
+		return
+	}
+	defer upstream.Close()
+	go func() {
+		_, _ = io.Copy(upstream, conn)
+		if cw, ok := upstream.(closeWriter); ok {
+			_ = cw.CloseWrite()
+		}
+	}()
+	_, _ = io.Copy(conn, upstream)
+}
+
+// RelayLogs writes the enclave's log stream (JSON records, one per line) to w,
+// reconnecting when the enclave restarts, until ctx is done.
+func (p *Proxy) RelayLogs(ctx context.Context, w io.Writer) {
+	for {
+		err := p.relayLogs(ctx, w)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn("Enclave log stream disconnected", "err", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(defaultLogRetryInterval):
+		}
+	}
+}
+
+func (p *Proxy) relayLogs(ctx context.Context, w io.Writer) error {
+	dialCtx, cancel := context.WithTimeout(ctx, p.cfg.DialTimeout)
+	conn, err := p.dial(dialCtx, p.cfg.TelemetryPort)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+	if _, err = conn.Write([]byte(telemetryLogsCommand + "\n")); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, conn)
+	if err == nil {
+		err = io.EOF
+	}
+	return err
+}
@@ -0,0 +1,275 @@
+// Package signing implements the hashing and signing of output proposals, shared by
+// the enclave, the proposer and offline verifiers.
+//
+// Version 0 is the legacy scheme verified by the OutputOracle contract, which signs
+// keccak256(configHash || l1OriginHash || l2BlockNumber || prevOutputRoot || outputRoot)
+// without domain separation. Version 1 signs EIP-712 typed data, with a domain that
+// binds the signature to the L1 chain, the L2 chain and the OutputOracle contract, so
+// that the same signer can be safely reused across chains and contracts. The enclave
+// signs with Version1 for chain configs that contain a signing domain.
+//
+// A proposal signed by several independent enclaves is submitted with a list of their
+// signatures, encoded by EncodeSignatures.
+//
+// Enclaves also sign an Envelope for each proposal, which is not verified onchain, but
+// records the request and enclave image that produced the proposal for auditing.
+package signing
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type Version uint8
+
+const (
+	// Version0 is the legacy packed encoding, without domain separation.
+	Version0 Version = 0
+	// Version1 is the EIP-712 typed data encoding.
+	Version1 Version = 1
+)
+
+const (
+	domainName    = "OpEnclave"
+	domainVersion = "1"
+)
+
+const envelopeTag = "op-enclave/envelope"
+
+var (
+	domainTypeHash   = crypto.Keccak256Hash([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"))
+	proposalTypeHash = crypto.Keccak256Hash([]byte("Proposal(uint256 l2ChainId,bytes32 configHash,bytes32 l1OriginHash,uint256 l2BlockNumber,bytes32 prevOutputRoot,bytes32 outputRoot)"))
+)
+
+// Domain identifies where a proposal is valid. It is required for Version1, and
+// ignored for Version0.
+type Domain struct {
+	L1ChainID    *big.Int
+	L2ChainID    *big.Int
+	OutputOracle common.Address
+}
+
+// Proposal contains the fields of an output proposal that are signed.
+type Proposal struct {
+	ConfigHash     common.Hash
+	L1OriginHash   common.Hash
+	L2BlockNumber  *big.Int
+	PrevOutputRoot common.Hash
+	OutputRoot     common.Hash
+}
+
+// Separator returns the EIP-712 domain separator.
+func (d *Domain) Separator() (common.Hash, error) {
+	if err := d.check(); err != nil {
+		return common.Hash{}, err
+	}
+	data := append(domainTypeHash[:], crypto.Keccak256([]byte(domainName))...)
+	data = append(data, crypto.Keccak256([]byte(domainVersion))...)
+	data = append(data, math.U256Bytes(new(big.Int).Set(d.L1ChainID))...)
+	data = append(data, common.LeftPadBytes(d.OutputOracle[:], 32)...)
+	return crypto.Keccak256Hash(data), nil
+}
+
+func (d *Domain) check() error {
+	if d == nil {
+		return errors.New("missing signing domain")
+	}
+	if d.L1ChainID == nil || d.L2ChainID == nil {
+		return errors.New("missing chain ID in signing domain")
+	}
+	if d.L1ChainID.Sign() < 0 || d.L2ChainID.Sign() < 0 {
+		return errors.New("negative chain ID in signing domain")
+	}
+	return nil
+}
+
+func (p *Proposal) check() error {
+	if p.L2BlockNumber == nil || p.L2BlockNumber.Sign() < 0 || p.L2BlockNumber.BitLen() > 256 {
+		return errors.New("invalid L2 block number")
+	}
+	return nil
+}
+
+// Hash returns the hash of the proposal that is signed.
+func Hash(version Version, domain *Domain, p *Proposal) (common.Hash, error) {
+	if err := p.check(); err != nil {
+		return common.Hash{}, err
+	}
+	number := math.U256Bytes(new(big.Int).Set(p.L2BlockNumber))
+	switch version {
+	case Version0:
+		data := append(p.ConfigHash[:], p.L1OriginHash[:]...)
+		data = append(data, number...)
+		data = append(data, p.PrevOutputRoot[:]...)
+		data = append(data, p.OutputRoot[:]...)
+		return crypto.Keccak256Hash(data), nil
+	case Version1:
+		separator, err := domain.Separator()
+		if err != nil {
+			return common.Hash{}, err
+		}
+		data := append(proposalTypeHash[:], math.U256Bytes(new(big.Int).Set(domain.L2ChainID))...)
+		data = append(data, p.ConfigHash[:]...)
+		data = append(data, p.L1OriginHash[:]...)
+		data = append(data, number...)
+		data = append(data, p.PrevOutputRoot[:]...)
+		data = append(data, p.OutputRoot[:]...)
+		structHash := crypto.Keccak256(data)
+		return crypto.Keccak256Hash([]byte{0x19, 0x01}, separator[:], structHash), nil
+	default:
+		return common.Hash{}, fmt.Errorf("unsupported signing version: %d", version)
+	}
+}
+
+// Sign signs the proposal. The recovery ID of the returned signature is 0 or 1, and
+// must be incremented by 27 before being verified onchain.
+func Sign(version Version, domain *Domain, p *Proposal, key *ecdsa.PrivateKey) ([]byte, error) {
+	hash, err := Hash(version, domain, p)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := crypto.Sign(hash[:], key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return sig, nil
+}
+
+// Recover returns the address of the signer of the proposal. Signatures with a
+// recovery ID of 0 or 1, or 27 or 28, are accepted.
+func Recover(version Version, domain *Domain, p *Proposal, signature []byte) (common.Address, error) {
+	if len(signature) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("invalid signature length: %d", len(signature))
+	}
+	hash, err := Hash(version, domain, p)
+	if err != nil {
+		return common.Address{}, err
+	}
+	sig := make([]byte, crypto.SignatureLength)
+	copy(sig, signature)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	public, err := crypto.SigToPub(hash[:], sig)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to recover signer: %w", err)
+	}
+	return crypto.PubkeyToAddress(*public), nil
+}
+
+// EncodeSignatures encodes signatures of the proposal by several signers into a single
+// signature list: the 65 byte signatures are concatenated in ascending order of signer
+// address, each with a recovery ID of 27 or 28, so that a verifier can reject repeated
+// signers by requiring increasing addresses. A single signature is encoded as the
+// OutputOracle verifies it.
+func EncodeSignatures(version Version, domain *Domain, p *Proposal, signatures [][]byte) ([]byte, error) {
+	if len(signatures) == 0 {
+		return nil, errors.New("no signatures")
+	}
+	type signed struct {
+		signer    common.Address
+		signature []byte
+	}
+	list := make([]signed, len(signatures))
+	for i, signature := range signatures {
+		signer, err := Recover(version, domain, p, signature)
+		if err != nil {
+			return nil, fmt.Errorf("signature %d: %w", i, err)
+		}
+		list[i] = signed{signer: signer, signature: signature}
+	}
+	slices.SortFunc(list, func(a, b signed) int {
+		return a.signer.Cmp(b.signer)
+	})
+	encoded := make([]byte, 0, len(list)*crypto.SignatureLength)
+	for i, s := range list {
+		if i > 0 && list[i-1].signer == s.signer {
+			return nil, fmt.Errorf("duplicate signer %s", s.signer)
+		}
+		encoded = append(encoded, s.signature...)
+		if v := &encoded[len(encoded)-1]; *v < 27 {
+			*v += 27
+		}
+	}
+	return encoded, nil
+}
+
+// RecoverSignatures returns the signers of a signature list encoded by EncodeSignatures,
+// in order. The signers must be in strictly ascending order.
+func RecoverSignatures(version Version, domain *Domain, p *Proposal, encoded []byte) ([]common.Address, error) {
+	if len(encoded) == 0 || len(encoded)%crypto.SignatureLength != 0 {
+		return nil, fmt.Errorf("invalid signature list length: %d", len(encoded))
+	}
+	signers := make([]common.Address, 0, len(encoded)/crypto.SignatureLength)
+	for offset := 0; offset < len(encoded); offset += crypto.SignatureLength {
+		signer, err := Recover(version, domain, p, encoded[offset:offset+crypto.SignatureLength])
+		if err != nil {
+			return nil, fmt.Errorf("signature %d: %w", len(signers), err)
+		}
+		if len(signers) > 0 && signers[len(signers)-1].Cmp(signer) >= 0 {
+			return nil, errors.New("signers are not in ascending order")
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+// Envelope binds a proposal signature to how the proposal was produced.
+type Envelope struct {
+	// RequestDigest is a hash of all inputs of the request that produced the proposal.
+	RequestDigest common.Hash
+	// PCR0 identifies the enclave image that signed the proposal.
+	PCR0 []byte
+	// InstanceID is generated randomly when the enclave starts, so that envelopes of
+	// enclaves sharing a signer key, or of the same enclave across restarts, are distinct.
+	InstanceID common.Hash
+	// Sequence is incremented for every proposal signed by the enclave instance.
+	Sequence uint64
+}
+
+// EnvelopeHash returns the hash of the envelope of the proposal with the given
+// signature, which is signed by the same signer as the proposal.
+func EnvelopeHash(proposalSignature []byte, e *Envelope) common.Hash {
+	data := append([]byte(envelopeTag), crypto.Keccak256(proposalSignature)...)
+	data = append(data, e.RequestDigest[:]...)
+	data = append(data, crypto.Keccak256(e.PCR0)...)
+	data = append(data, e.InstanceID[:]...)
+	data = append(data, math.U256Bytes(new(big.Int).SetUint64(e.Sequence))...)
+	return crypto.Keccak256Hash(data)
+}
+
+// SignEnvelope signs the envelope of the proposal with the given signature.
+func SignEnvelope(proposalSignature []byte, e *Envelope, key *ecdsa.PrivateKey) ([]byte, error) {
+	hash := EnvelopeHash(proposalSignature, e)
+	sig, err := crypto.Sign(hash[:], key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign envelope: %w", err)
+	}
+	return sig, nil
+}
+
+// RecoverEnvelope returns the address of the signer of the envelope, which must equal
+// the signer of the proposal for the envelope to be valid.
+func RecoverEnvelope(proposalSignature []byte, e *Envelope, signature []byte) (common.Address, error) {
+	if len(signature) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("invalid signature length: %d", len(signature))
+	}
+	hash := EnvelopeHash(proposalSignature, e)
+	sig := make([]byte, crypto.SignatureLength)
+	copy(sig, signature)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	public, err := crypto.SigToPub(hash[:], sig)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to recover signer: %w", err)
+	}
+	return crypto.PubkeyToAddress(*public), nil
+}
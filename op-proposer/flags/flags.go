@@ -24,25 +24,82 @@ var (
 		Value:    false,
 		Required: false,
 	}
-	EnclaveRpcFlag = &cli.StringFlag{
+	EnclaveRpcFlag = &cli.StringSliceFlag{
 		Name:     "enclave-rpc",
-		Usage:    "HTTP provider URL for the enclave service",
+		Usage:    "HTTP provider URLs for the enclave services; each enclave signs every proposal",
 		EnvVars:  prefixEnvVar("ENCLAVE_RPC"),
 		Required: true,
 	}
+	EnclaveThresholdFlag = &cli.Uint64Flag{
+		Name:    "enclave-threshold",
+		Usage:   "Number of enclave signatures required for, and submitted with, each proposal",
+		EnvVars: prefixEnvVar("ENCLAVE_THRESHOLD"),
+		Value:   1,
+	}
 	MinProposalIntervalFlag = &cli.Uint64Flag{
 		Name:    "min-proposal-interval",
 		Usage:   "Minimum time between proposals (in L2 blocks)",
 		EnvVars: prefixEnvVar("MIN_PROPOSAL_INTERVAL"),
 		Value:   600,
 	}
+	EnclaveConfigVersionFlag = &cli.Uint64Flag{
+		Name:    "enclave-config-version",
+		Usage:   "Version of the enclave chain config, whose hash must match the OutputOracle's config hash (0 uses the default block time, derivation parameters and hardforks, 1 takes them from the rollup config, 2 also signs proposals with EIP-712 typed data bound to the L1 chain and OutputOracle)",
+		EnvVars: prefixEnvVar("ENCLAVE_CONFIG_VERSION"),
+		Value:   0,
+	}
+	ExecutionRangeSizeFlag = &cli.Uint64Flag{
+		Name:    "execution-range-size",
+		Usage:   "Maximum number of L2 blocks to execute in a single enclave call (requires enclave_executeStatelessRange if > 1)",
+		EnvVars: prefixEnvVar("EXECUTION_RANGE_SIZE"),
+		Value:   1,
+	}
+	EnclaveWireFormatFlag = &cli.StringFlag{
+		Name:    "enclave-wire-format",
+		Usage:   "Wire format for enclave execution payloads (json, rlp, rlp+snappy, rlp+zstd); negotiated with the enclave if empty",
+		EnvVars: prefixEnvVar("ENCLAVE_WIRE_FORMAT"),
+	}
+	CaptureDirFlag = &cli.StringFlag{
+		Name:    "capture-dir",
+		Usage:   "Directory to write enclave execution inputs to when the enclave rejects a block, for use with enclave-replay",
+		EnvVars: prefixEnvVar("CAPTURE_DIR"),
+	}
+	CaptureBlocksFlag = &cli.Uint64SliceFlag{
+		Name:    "capture-blocks",
+		Usage:   "L2 block numbers to always capture enclave execution inputs for (requires capture-dir)",
+		EnvVars: prefixEnvVar("CAPTURE_BLOCKS"),
+	}
+	EnvelopeDirFlag = &cli.StringFlag{
+		Name:    "envelope-dir",
+		Usage:   "Directory to write the signed response envelopes of each proposal to, for auditing",
+		EnvVars: prefixEnvVar("ENVELOPE_DIR"),
+	}
+	EnclavePCR0Flag = &cli.StringSliceFlag{
+		Name:    "enclave-pcr0",
+		Usage:   "Accepted PCR0 values of the enclave image; if set, the enclave RPCs (https:// URLs) are verified using the attestation in its RA-TLS certificate",
+		EnvVars: prefixEnvVar("ENCLAVE_PCR0"),
+	}
+	EnclaveCARootsFlag = &cli.StringFlag{
+		Name:    "enclave-ca-roots",
+		Usage:   "PEM file containing the CA roots for enclave RA-TLS attestations (defaults to the AWS Nitro Enclaves root)",
+		EnvVars: prefixEnvVar("ENCLAVE_CA_ROOTS"),
+	}
 )
 
 var requiredFlags = []cli.Flag{
 	L2EthRpcFlag,
 	L2RethFlag,
 	EnclaveRpcFlag,
+	EnclaveThresholdFlag,
 	MinProposalIntervalFlag,
+	EnclaveConfigVersionFlag,
+	ExecutionRangeSizeFlag,
+	EnclaveWireFormatFlag,
+	CaptureDirFlag,
+	CaptureBlocksFlag,
+	EnvelopeDirFlag,
+	EnclavePCR0Flag,
+	EnclaveCARootsFlag,
 }
 
 func init() {
@@ -10,8 +10,17 @@ type CLIConfig struct {
 	*proposer.CLIConfig
 	L2EthRpc            string
 	L2Reth              bool
-	EnclaveRpc          string
+	EnclaveRpcs         []string
+	EnclaveThreshold    uint64
 	MinProposalInterval uint64
+	ConfigVersion       uint64
+	ExecutionRangeSize  uint64
+	EnclaveWireFormat   string
+	CaptureDir          string
+	CaptureBlocks       []uint64
+	EnvelopeDir         string
+	EnclavePCR0         []string
+	EnclaveCARoots      string
 }
 
 func NewConfig(ctx *cli.Context) *CLIConfig {
@@ -19,7 +28,16 @@ func NewConfig(ctx *cli.Context) *CLIConfig {
 		CLIConfig:           proposer.NewConfig(ctx),
 		L2EthRpc:            ctx.String(flags.L2EthRpcFlag.Name),
 		L2Reth:              ctx.Bool(flags.L2RethFlag.Name),
-		EnclaveRpc:          ctx.String(flags.EnclaveRpcFlag.Name),
+		EnclaveRpcs:         ctx.StringSlice(flags.EnclaveRpcFlag.Name),
+		EnclaveThreshold:    ctx.Uint64(flags.EnclaveThresholdFlag.Name),
 		MinProposalInterval: ctx.Uint64(flags.MinProposalIntervalFlag.Name),
+		ConfigVersion:       ctx.Uint64(flags.EnclaveConfigVersionFlag.Name),
+		ExecutionRangeSize:  ctx.Uint64(flags.ExecutionRangeSizeFlag.Name),
+		EnclaveWireFormat:   ctx.String(flags.EnclaveWireFormatFlag.Name),
+		CaptureDir:          ctx.String(flags.CaptureDirFlag.Name),
+		CaptureBlocks:       ctx.Uint64Slice(flags.CaptureBlocksFlag.Name),
+		EnvelopeDir:         ctx.String(flags.EnvelopeDirFlag.Name),
+		EnclavePCR0:         ctx.StringSlice(flags.EnclavePCR0Flag.Name),
+		EnclaveCARoots:      ctx.String(flags.EnclaveCARootsFlag.Name),
 	}
 }
@@ -16,7 +16,9 @@ import (
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rpc"
 )
@@ -36,17 +38,22 @@ func init() {
 type OOContract interface {
 	Version(*bind.CallOpts) (string, error)
 	LatestL2Output(opts *bind.CallOpts) (bindings.TypesOutputProposal, error)
+	SystemConfigGlobal(opts *bind.CallOpts) (common.Address, error)
+}
+
+type SCGContract interface {
+	ValidSigners(opts *bind.CallOpts, signer common.Address) (bool, error)
 }
 
 type DriverSetup struct {
-	Log           log.Logger
-	Metr          metrics.Metricer
-	Cfg           ProposerConfig
-	Txmgr         txmgr.TxManager
-	L1Client      L1Client
-	L2Client      L2Client
-	RollupClient  RollupClient
-	EnclaveClient enclave.RPC
+	Log            log.Logger
+	Metr           metrics.Metricer
+	Cfg            ProposerConfig
+	Txmgr          txmgr.TxManager
+	L1Client       L1Client
+	L2Client       L2Client
+	RollupClient   RollupClient
+	EnclaveClients []enclave.RPC
 }
 
 // L2OutputSubmitter is responsible for proposing outputs
@@ -62,8 +69,9 @@ type L2OutputSubmitter struct {
 	mutex   sync.Mutex
 	running bool
 
-	ooContract OOContract
-	ooABI      *abi.ABI
+	ooContract  OOContract
+	ooABI       *abi.ABI
+	scgContract SCGContract
 
 	prover  *Prover
 	pending []*Proposal
@@ -100,17 +108,50 @@ func newL2OOSubmitter(ctx context.Context, cancel context.CancelFunc, setup Driv
 	}
 	log.Info("Connected to L2OutputOracle", "address", setup.Cfg.L2OutputOracleAddr, "version", version)
 
+	scgAddress, err := ooContract.SystemConfigGlobal(&bind.CallOpts{Context: cCtx})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to fetch SystemConfigGlobal address: %w", err)
+	}
+	scgContract, err := bindings.NewSystemConfigGlobalCaller(scgAddress, setup.L1Client)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create SystemConfigGlobal at address %s: %w", scgAddress, err)
+	}
+
+	for i, enclaveClient := range setup.EnclaveClients {
+		status, err := enclaveClient.Status(cCtx)
+		if enclave.IsMethodNotFound(err) {
+			log.Warn("Enclave does not support enclave_status, it may be running an older image", "enclave", i)
+			continue
+		} else if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to fetch status of enclave %d: %w", i, err)
+		}
+		log.Info("Connected to enclave", "enclave", i, "pcr0", status.PCR0, "signer", status.SignerAddress, "local", status.Local)
+	}
+
 	parsed, err := bindings.OutputOracleMetaData.GetAbi()
 	if err != nil {
 		cancel()
 		return nil, err
 	}
 
-	prover, err := NewProver(cCtx, setup.L1Client, setup.L2Client, setup.RollupClient, setup.EnclaveClient)
+	prover, err := NewProver(cCtx, setup.L1Client, setup.L2Client, setup.RollupClient, setup.Cfg.ConfigVersion, *setup.Cfg.L2OutputOracleAddr, setup.EnclaveClients,
+		max(setup.Cfg.EnclaveThreshold, 1), setup.Cfg.CaptureDir, setup.Cfg.CaptureBlocks,
+		setup.Cfg.EnvelopeDir)
 	if err != nil {
 		cancel()
 		return nil, err
 	}
+	// a mismatch is only logged, so that it does not prevent existing deployments from
+	// starting
+	if configHash, err := ooContract.ConfigHash(&bind.CallOpts{Context: cCtx}); err != nil {
+		log.Warn("Failed to fetch OutputOracle config hash", "err", err)
+	} else if prover.ConfigHash() != configHash {
+		log.Warn("Enclave config hash does not match the OutputOracle config hash, proposals will be rejected",
+			"enclave", prover.ConfigHash(), "version", setup.Cfg.ConfigVersion, "oracle", common.Hash(configHash))
+	}
 
 	return &L2OutputSubmitter{
 		DriverSetup: setup,
@@ -118,9 +159,10 @@ func newL2OOSubmitter(ctx context.Context, cancel context.CancelFunc, setup Driv
 		ctx:         ctx,
 		cancel:      cancel,
 
-		ooContract: ooContract,
-		ooABI:      parsed,
-		prover:     prover,
+		ooContract:  ooContract,
+		ooABI:       parsed,
+		scgContract: scgContract,
+		prover:      prover,
 	}, nil
 }
 
@@ -212,20 +254,25 @@ func (l *L2OutputSubmitter) loop() {
 				continue
 			}
 
+			if err = l.checkEnclaveSigner(ctx); err != nil {
+				l.Log.Warn("Enclave signer check failed", "err", err)
+				continue
+			}
+
 			if err = l.generateOutputs(ctx, latestOutput); err != nil {
 				l.Log.Warn("Error generating output", "err", err)
 				continue
 			}
 
-			proposal, shouldPropose, err := l.nextOutput(ctx, latestOutput)
+			proposal, signatures, err := l.nextOutput(ctx, latestOutput)
 			if err != nil {
 				l.Log.Warn("Error getting output", "err", err)
 				continue
-			} else if !shouldPropose {
+			} else if signatures == nil {
 				continue
 			}
 
-			l.proposeOutput(ctx, proposal)
+			l.proposeOutput(ctx, proposal, signatures)
 		case <-l.done:
 			return
 		}
@@ -238,6 +285,90 @@ func (l *L2OutputSubmitter) IsRunning() bool {
 	return l.running
 }
 
+// checkEnclaveSigner checks that the signers of at least the threshold of enclaves are
+// registered in SystemConfigGlobal, so that no effort is spent generating proofs that
+// would be rejected onchain.
+func (l *L2OutputSubmitter) checkEnclaveSigner(ctx context.Context) error {
+	var errs []error
+	for i, enclaveClient := range l.EnclaveClients {
+		if err := l.checkEnclaveClientSigner(ctx, enclaveClient); err != nil {
+			errs = append(errs, fmt.Errorf("enclave %d: %w", i, err))
+		}
+	}
+	if len(l.EnclaveClients)-len(errs) < l.prover.Threshold() {
+		return errors.Join(errs...)
+	}
+	for _, err := range errs {
+		l.Log.Warn("Enclave signer check failed", "err", err)
+	}
+	return nil
+}
+
+func (l *L2OutputSubmitter) checkEnclaveClientSigner(ctx context.Context, enclaveClient enclave.RPC) error {
+	signer, err := enclaveSignerAddress(ctx, enclaveClient)
+	if err != nil {
+		return err
+	}
+	valid, err := l.scgContract.ValidSigners(&bind.CallOpts{Context: ctx}, signer)
+	if err != nil {
+		return fmt.Errorf("failed to check signer registration: %w", err)
+	}
+	if !valid {
+		return fmt.Errorf("enclave signer %s is not registered in SystemConfigGlobal", signer)
+	}
+	return nil
+}
+
+// enclaveSignerAddress returns the address of the enclave's signer key, falling back to
+// enclave_signerPublicKey for enclaves that do not support enclave_status.
+func enclaveSignerAddress(ctx context.Context, enclaveClient enclave.RPC) (common.Address, error) {
+	status, err := enclaveClient.Status(ctx)
+	if err == nil {
+		return status.SignerAddress, nil
+	}
+	if !enclave.IsMethodNotFound(err) {
+		return common.Address{}, fmt.Errorf("failed to fetch enclave status: %w", err)
+	}
+	publicKey, err := enclaveClient.SignerPublicKey(ctx)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to fetch enclave signer public key: %w", err)
+	}
+	public, err := crypto.UnmarshalPubkey(publicKey)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to parse enclave signer public key: %w", err)
+	}
+	return crypto.PubkeyToAddress(*public), nil
+}
+
+// proposalSignatures selects the threshold of the proposal's signatures whose signers
+// are registered in SystemConfigGlobal, in the order of the enclaves, and encodes them,
+// so that a proposal that would revert onchain is not submitted.
+func (l *L2OutputSubmitter) proposalSignatures(ctx context.Context, prevOutputRoot common.Hash, proposal *Proposal) ([]byte, error) {
+	signers, err := l.prover.Signers(prevOutputRoot, proposal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover proposal signers: %w", err)
+	}
+	var selected [][]byte
+	for i, signer := range signers {
+		if proposal.Signatures[i] == nil || len(selected) == l.prover.Threshold() {
+			continue
+		}
+		valid, err := l.scgContract.ValidSigners(&bind.CallOpts{Context: ctx}, signer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check signer registration: %w", err)
+		}
+		if !valid {
+			l.Log.Warn("Proposal signer is not registered in SystemConfigGlobal", "enclave", i, "signer", signer)
+			continue
+		}
+		selected = append(selected, proposal.Signatures[i])
+	}
+	if len(selected) < l.prover.Threshold() {
+		return nil, fmt.Errorf("proposal has %d signatures by registered signers, %d required", len(selected), l.prover.Threshold())
+	}
+	return l.prover.EncodeSignatures(prevOutputRoot, proposal, selected)
+}
+
 func (l *L2OutputSubmitter) generateOutputs(ctx context.Context, latestOutput bindings.TypesOutputProposal) error {
 	latestOutputNumber := latestOutput.L2BlockNumber.Uint64()
 
@@ -258,23 +389,39 @@ func (l *L2OutputSubmitter) generateOutputs(ctx context.Context, latestOutput bi
 	}
 
 	// calculate `aggregateBatchSize` proofs at once, which are then aggregated in `nextOutput`
-	for i := uint64(0); i < aggregateBatchSize; i++ {
-		number := i + latestOutputNumber + 1
-		block, err := l.L2Client.BlockByNumber(ctx, new(big.Int).SetUint64(number))
-		if errors.Is(err, ethereum.NotFound) {
-			break
+	rangeSize := max(l.Cfg.ExecutionRangeSize, 1)
+	for i, done := uint64(0), false; i < aggregateBatchSize && !done; {
+		var blocks []*types.Block
+		for ; i < aggregateBatchSize && uint64(len(blocks)) < rangeSize; i++ {
+			number := i + latestOutputNumber + 1
+			block, err := l.L2Client.BlockByNumber(ctx, new(big.Int).SetUint64(number))
+			if errors.Is(err, ethereum.NotFound) {
+				done = true
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to get block %d: %w", number, err)
+			}
+			blocks = append(blocks, block)
 		}
-		if err != nil {
-			return fmt.Errorf("failed to get block %d: %w", number, err)
+		if len(blocks) == 0 {
+			break
 		}
 
-		proposal, err := l.prover.Generate(ctx, block)
+		proposal, err := l.prover.GenerateRange(ctx, blocks)
 		if err != nil {
-			return fmt.Errorf("failed to generate proof for block %d: %w", number, err)
+			if enclaveErr := enclave.ParseError(err); enclaveErr != nil &&
+				(enclaveErr.Code == enclave.ErrorCodeInvalidBlock || enclaveErr.Code == enclave.ErrorCodeEquivocation) {
+				// the block is invalid, or differs from one already signed, which usually means it was reorged
+				l.Log.Warn("Enclave rejected block, clearing pending proofs", "err", err,
+					"check", enclaveErr.Check, "expected", enclaveErr.Expected, "actual", enclaveErr.Actual)
+				l.pending = nil
+			}
+			return fmt.Errorf("failed to generate proof for blocks %d-%d: %w", blocks[0].NumberU64(), blocks[len(blocks)-1].NumberU64(), err)
 		}
 
-		l.Log.Info("Generated proof for block",
-			"block", l2BlockRefToBlockID(proposal.To), "l1Origin", proposal.To.L1Origin,
+		l.Log.Info("Generated proof for blocks",
+			"from", l2BlockRefToBlockID(proposal.From), "to", l2BlockRefToBlockID(proposal.To), "l1Origin", proposal.To.L1Origin,
 			"withdrawals", proposal.Withdrawals, "output", proposal.Output.OutputRoot.String())
 		l.pending = append(l.pending, proposal)
 	}
@@ -282,11 +429,13 @@ func (l *L2OutputSubmitter) generateOutputs(ctx context.Context, latestOutput bi
 	return nil
 }
 
-func (l *L2OutputSubmitter) nextOutput(ctx context.Context, latestOutput bindings.TypesOutputProposal) (*Proposal, bool, error) {
+// nextOutput aggregates the pending proposals, and returns the next proposal with its
+// encoded signatures, which are nil if it should not be submitted yet.
+func (l *L2OutputSubmitter) nextOutput(ctx context.Context, latestOutput bindings.TypesOutputProposal) (*Proposal, []byte, error) {
 	// aggregate proposals up to the latest safe block
 	latestSafe, err := l.latestSafeBlock(ctx)
 	if err != nil {
-		return nil, false, err
+		return nil, nil, err
 	}
 
 	count := 0
@@ -294,7 +443,7 @@ func (l *L2OutputSubmitter) nextOutput(ctx context.Context, latestOutput binding
 		count++
 	}
 	if count <= 0 {
-		return nil, false, nil
+		return nil, nil, nil
 	}
 
 	for count > 1 {
@@ -302,13 +451,12 @@ func (l *L2OutputSubmitter) nextOutput(ctx context.Context, latestOutput binding
 		batch := l.pending[:batchLength]
 		aggregated, err := l.prover.Aggregate(ctx, latestOutput.OutputRoot, batch)
 		if err != nil {
-			var rpcError rpc.Error
-			if errors.As(err, &rpcError) {
-				// if we received an explicit error from the enclave (like "invalid signer"), clear the pending proofs
+			if isNonRecoverableAggregateError(err) {
+				// if we received an explicit error from the enclave (like "invalid signature"), clear the pending proofs
 				l.Log.Warn("Non-recoverable error aggregating proofs", "err", err)
 				l.pending = nil
 			}
-			return nil, false, err
+			return nil, nil, err
 		}
 		l.pending = append([]*Proposal{aggregated}, l.pending[batchLength:]...)
 		count -= batchLength - 1
@@ -321,14 +469,14 @@ func (l *L2OutputSubmitter) nextOutput(ctx context.Context, latestOutput binding
 	if proposal.To.Number < latestSafe.Number {
 		l.Log.Info("Aggregated output is not the latest safe block, waiting for more proofs",
 			"aggregated", l2BlockRefToBlockID(proposal.To), "latestSafe", latestSafe)
-		return nil, false, nil
+		return nil, nil, nil
 	}
 
 	if proposal.To.Hash != latestSafe.Hash {
 		l.Log.Warn("Aggregated output does not match the latest batched block, possible reorg",
 			"aggregated", l2BlockRefToBlockID(proposal.To), "latestSafe", latestSafe)
 		l.pending = nil
-		return nil, false, nil
+		return nil, nil, nil
 	}
 
 	shouldPropose := proposal.Withdrawals ||
@@ -347,14 +495,39 @@ func (l *L2OutputSubmitter) nextOutput(ctx context.Context, latestOutput binding
 		}
 	}
 
-	return proposal, shouldPropose, nil
+	if !shouldPropose {
+		return proposal, nil, nil
+	}
+	signatures, err := l.proposalSignatures(ctx, latestOutput.OutputRoot, proposal)
+	if err != nil {
+		log.Warn("Not submitting proposal, invalid signers", "err", err)
+		return proposal, nil, nil
+	}
+	return proposal, signatures, nil
+}
+
+// isNonRecoverableAggregateError returns true if retrying the aggregation of the same
+// proofs cannot succeed, so they should be dropped and regenerated. Unauthorized errors
+// are retried, as they depend on the enclave's state (e.g. its config allowlist or
+// trusted signers) rather than on the proofs, and regenerating the proofs would not help.
+func isNonRecoverableAggregateError(err error) bool {
+	if enclaveErr := enclave.ParseError(err); enclaveErr != nil {
+		switch enclaveErr.Code {
+		case enclave.ErrorCodeInternal, enclave.ErrorCodeLimitExceeded, enclave.ErrorCodeUnauthorized:
+			return false
+		}
+		return true
+	}
+	// enclaves without structured errors return generic codes, so treat any explicit error as non-recoverable
+	var rpcError rpc.Error
+	return errors.As(err, &rpcError)
 }
 
-func (l *L2OutputSubmitter) proposeOutput(ctx context.Context, proposal *Proposal) {
+func (l *L2OutputSubmitter) proposeOutput(ctx context.Context, proposal *Proposal, signatures []byte) {
 	cCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
 	defer cancel()
 
-	if err := l.sendTransaction(cCtx, proposal); err != nil {
+	if err := l.sendTransaction(cCtx, proposal, signatures); err != nil {
 		l.Log.Error("Failed to send proposal transaction",
 			"err", err,
 			"block", l2BlockRefToBlockID(proposal.To))
@@ -364,9 +537,9 @@ func (l *L2OutputSubmitter) proposeOutput(ctx context.Context, proposal *Proposa
 }
 
 // sendTransaction creates & sends transactions through the underlying transaction manager.
-func (l *L2OutputSubmitter) sendTransaction(ctx context.Context, proposal *Proposal) error {
+func (l *L2OutputSubmitter) sendTransaction(ctx context.Context, proposal *Proposal, signatures []byte) error {
 	l.Log.Info("Proposing output root", "output", proposal.Output.OutputRoot, "block", l2BlockRefToBlockID(proposal.To))
-	data, err := l.ProposeL2OutputTxData(proposal)
+	data, err := l.ProposeL2OutputTxData(proposal, signatures)
 	if err != nil {
 		return err
 	}
@@ -387,21 +560,19 @@ func (l *L2OutputSubmitter) sendTransaction(ctx context.Context, proposal *Propo
 	return nil
 }
 
-// ProposeL2OutputTxData creates the transaction data for the ProposeL2Output function
-func (l *L2OutputSubmitter) ProposeL2OutputTxData(proposal *Proposal) ([]byte, error) {
-	return proposeL2OutputTxData(l.ooABI, proposal)
+// ProposeL2OutputTxData creates the transaction data for the ProposeL2Output function,
+// with the signature list encoded by signing.EncodeSignatures.
+func (l *L2OutputSubmitter) ProposeL2OutputTxData(proposal *Proposal, signatures []byte) ([]byte, error) {
+	return proposeL2OutputTxData(l.ooABI, proposal, signatures)
 }
 
 // proposeL2OutputTxData creates the transaction data for the ProposeL2Output function
-func proposeL2OutputTxData(abi *abi.ABI, proposal *Proposal) ([]byte, error) {
-	sig := make([]byte, len(proposal.Output.Signature))
-	copy(sig, proposal.Output.Signature)
-	sig[64] += 27
+func proposeL2OutputTxData(abi *abi.ABI, proposal *Proposal, signatures []byte) ([]byte, error) {
 	return abi.Pack(
 		"proposeL2Output",
 		proposal.Output.OutputRoot,
 		new(big.Int).SetUint64(proposal.To.Number),
 		new(big.Int).SetUint64(proposal.To.L1Origin.Number),
-		sig,
+		signatures,
 	)
 }
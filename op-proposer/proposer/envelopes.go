@@ -0,0 +1,65 @@
+package proposer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/base/op-enclave/op-enclave/enclave"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// envelopeRecord is written to the envelope directory for each generated or aggregated
+// proposal, with the output of each enclave that signed it. The envelopes of the
+// outputs contain the digests of the enclave requests: the execution of the blocks
+// From to To for a generated proposal, or the aggregation of the proposals of Parts
+// from PrevOutputRoot for an aggregated one. An output root submitted onchain can be
+// traced through the aggregated records to the generated ones, and their inputs can be
+// fetched again and checked against the request digests.
+type envelopeRecord struct {
+	ConfigHash     common.Hash         `json:"config_hash"`
+	From           eth.L2BlockRef      `json:"from"`
+	To             eth.L2BlockRef      `json:"to"`
+	PrevOutputRoot *common.Hash        `json:"prev_output_root,omitempty"`
+	Parts          []*envelopePart     `json:"parts,omitempty"`
+	Outputs        []*enclave.Proposal `json:"outputs"`
+}
+
+type envelopePart struct {
+	From       uint64      `json:"from"`
+	To         uint64      `json:"to"`
+	OutputRoot common.Hash `json:"output_root"`
+}
+
+// writeEnvelopes writes the outputs of the enclaves that succeeded to the envelope
+// directory, if enabled.
+func (o *Prover) writeEnvelopes(name string, record *envelopeRecord, outputs []*enclave.Proposal, errs []error) {
+	if o.envelopeDir == "" {
+		return
+	}
+	record.ConfigHash = o.configHash
+	for i, output := range outputs {
+		if errs[i] == nil && output != nil {
+			record.Outputs = append(record.Outputs, output)
+		}
+	}
+	path := filepath.Join(o.envelopeDir, name)
+	data, err := json.Marshal(record)
+	if err == nil {
+		err = os.WriteFile(path, data, 0o644)
+	}
+	if err != nil {
+		log.Warn("Failed to write proposal envelopes", "path", path, "err", err)
+	}
+}
+
+func generatedEnvelopesName(from, to eth.L2BlockRef) string {
+	return fmt.Sprintf("envelope-%d-%d.json", from.Number, to.Number)
+}
+
+func aggregatedEnvelopesName(from, to eth.L2BlockRef) string {
+	return fmt.Sprintf("envelope-aggregate-%d-%d.json", from.Number, to.Number)
+}
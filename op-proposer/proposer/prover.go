@@ -2,9 +2,14 @@ package proposer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
 
 	"github.com/base/op-enclave/op-enclave/enclave"
+	"github.com/base/op-enclave/op-enclave/signing"
 	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
 	"github.com/ethereum-optimism/optimism/op-service/eth"
 	"github.com/ethereum-optimism/optimism/op-service/predeploys"
@@ -12,6 +17,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/stateless"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/hashicorp/go-multierror"
 )
 
@@ -20,11 +26,19 @@ type Prover struct {
 	configHash common.Hash
 	l1         L1Client
 	l2         L2Client
-	enclave    enclave.RPC
+	enclaves   []enclave.RPC
+	threshold  int
+
+	captureDir    string
+	captureBlocks map[uint64]struct{}
+	envelopeDir   string
 }
 
 type Proposal struct {
-	Output      *enclave.Proposal
+	Output *enclave.Proposal
+	// Signatures contains the signature of Output by each of the Prover's enclaves, in
+	// order, or nil if the enclave failed to sign it.
+	Signatures  []hexutil.Bytes
 	From        eth.L2BlockRef
 	To          eth.L2BlockRef
 	Withdrawals bool
@@ -35,24 +49,270 @@ func NewProver(
 	l1 L1Client,
 	l2 L2Client,
 	rollup RollupClient,
-	enclav enclave.RPC,
+	configVersion uint64,
+	outputOracle common.Address,
+	enclaves []enclave.RPC,
+	threshold uint64,
+	captureDir string,
+	captureBlocks []uint64,
+	envelopeDir string,
 ) (*Prover, error) {
 	rollupConfig, err := rollup.RollupConfig(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch rollup config: %w", err)
 	}
-	cfg := enclave.FromRollupConfig(rollupConfig)
+	cfg, err := enclave.FromRollupConfig(rollupConfig, configVersion, outputOracle)
+	if err != nil {
+		return nil, err
+	}
+	if err = cfg.Check(); err != nil {
+		return nil, fmt.Errorf("invalid enclave config: %w", err)
+	}
+	if configVersion == 0 && !enclave.Version0Compatible(rollupConfig) {
+		log.Warn("Rollup config differs from the defaults of version 0 enclave configs, which are used instead; " +
+			"switch to config version 1 after migrating the OutputOracle config hash")
+	}
+	if threshold < 1 || threshold > uint64(len(enclaves)) {
+		return nil, fmt.Errorf("invalid enclave threshold %d of %d enclaves", threshold, len(enclaves))
+	}
 
+	blocks := make(map[uint64]struct{}, len(captureBlocks))
+	for _, number := range captureBlocks {
+		blocks[number] = struct{}{}
+	}
 	return &Prover{
-		config:     cfg,
-		configHash: cfg.Hash(),
-		l1:         l1,
-		l2:         l2,
-		enclave:    enclav,
+		config:        cfg,
+		configHash:    cfg.Hash(),
+		l1:            l1,
+		l2:            l2,
+		enclaves:      enclaves,
+		threshold:     int(threshold),
+		captureDir:    captureDir,
+		captureBlocks: blocks,
+		envelopeDir:   envelopeDir,
 	}, nil
 }
 
+type proverInput struct {
+	enclave.BlockInput
+	blockRef           eth.L2BlockRef
+	prevMessageAccount *eth.AccountResult
+	withdrawals        bool
+}
+
 func (o *Prover) Generate(ctx context.Context, block *types.Block) (*Proposal, error) {
+	return o.GenerateRange(ctx, []*types.Block{block})
+}
+
+// GenerateRange generates a single proposal for a contiguous range of blocks. Ranges
+// longer than one block are executed using a single enclave_executeStatelessRange call.
+func (o *Prover) GenerateRange(ctx context.Context, blocks []*types.Block) (*Proposal, error) {
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no blocks to generate a proposal for")
+	}
+	inputs, err := o.fetchInputs(ctx, blocks)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([]*enclave.Proposal, len(o.enclaves))
+	errs := o.executeAll(ctx, inputs, outputs)
+	if slices.ContainsFunc(errs, isInputMismatch) {
+		// witnesses are not cached, so fetching the inputs again can resolve a mismatch
+		inputs, err = o.fetchInputs(ctx, blocks)
+		if err != nil {
+			return nil, err
+		}
+		errs = o.executeAll(ctx, inputs, outputs)
+	}
+	o.capture(inputs, errors.Join(errs...))
+	first := inputs[0]
+	last := inputs[len(inputs)-1]
+	for i, output := range outputs {
+		if errs[i] == nil {
+			errs[i] = checkOutput(output, last)
+		}
+	}
+	output, signatures, err := o.collect(outputs, errs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute enclave state transition: %w", err)
+	}
+	o.writeEnvelopes(generatedEnvelopesName(first.blockRef, last.blockRef), &envelopeRecord{
+		From: first.blockRef,
+		To:   last.blockRef,
+	}, outputs, errs)
+	withdrawals := false
+	for _, input := range inputs {
+		withdrawals = withdrawals || input.withdrawals
+	}
+	return &Proposal{
+		Output:      output,
+		Signatures:  signatures,
+		From:        first.blockRef,
+		To:          last.blockRef,
+		Withdrawals: withdrawals,
+	}, nil
+}
+
+func (o *Prover) fetchInputs(ctx context.Context, blocks []*types.Block) ([]*proverInput, error) {
+	inputs := make([]*proverInput, len(blocks))
+	for i, block := range blocks {
+		input, err := o.fetchInput(ctx, block)
+		if err != nil {
+			return nil, err
+		}
+		inputs[i] = input
+	}
+	return inputs, nil
+}
+
+// executeAll executes the inputs on each enclave concurrently, skipping enclaves that
+// already have an output, and returns the error of each enclave.
+func (o *Prover) executeAll(ctx context.Context, inputs []*proverInput, outputs []*enclave.Proposal) []error {
+	errs := make([]error, len(o.enclaves))
+	var wg sync.WaitGroup
+	for i, enclav := range o.enclaves {
+		if outputs[i] != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			output, err := o.execute(ctx, enclav, inputs)
+			if err == nil {
+				outputs[i] = output
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func (o *Prover) execute(ctx context.Context, enclav enclave.RPC, inputs []*proverInput) (*enclave.Proposal, error) {
+	first := inputs[0]
+	// the single block method predates L1 origin chains
+	if len(inputs) == 1 && len(first.L1OriginChain) == 0 {
+		return enclav.ExecuteStateless(
+			ctx,
+			o.config,
+			first.L1Origin,
+			first.L1Receipts,
+			first.PreviousBlockTxs,
+			first.BlockHeader,
+			first.SequencedTxs,
+			first.Witness,
+			first.MessageAccount,
+			first.prevMessageAccount,
+		)
+	}
+	blockInputs := make([]*enclave.BlockInput, len(inputs))
+	for i, input := range inputs {
+		blockInputs[i] = &input.BlockInput
+	}
+	return enclav.ExecuteStatelessRange(ctx, o.config, first.prevMessageAccount, blockInputs)
+}
+
+func isInputMismatch(err error) bool {
+	enclaveErr := enclave.ParseError(err)
+	return enclaveErr != nil && enclaveErr.Code == enclave.ErrorCodeInputMismatch
+}
+
+// checkOutput checks that an enclave's output matches the last block of the inputs.
+func checkOutput(output *enclave.Proposal, last *proverInput) error {
+	if output.L1OriginHash != last.blockRef.L1Origin.Hash {
+		return fmt.Errorf("output L1 origin hash does not match expected: %s != %s", output.L1OriginHash, last.blockRef.L1Origin.Hash)
+	}
+	if output.L2BlockNumber.ToInt().Cmp(last.BlockHeader.Number) != 0 {
+		return fmt.Errorf("output L2 block number does not match expected: %s != %s", output.L2BlockNumber, last.BlockHeader.Number)
+	}
+	outputRoot := enclave.OutputRootV0(last.BlockHeader, last.MessageAccount.StorageHash)
+	if output.OutputRoot != outputRoot {
+		return fmt.Errorf("output root does not match expected: %s != %s", output.OutputRoot, outputRoot)
+	}
+	return nil
+}
+
+// collect groups the outputs of the enclaves that succeeded by their output root, L1
+// origin and L2 block number, and returns the output of the largest group, with the
+// signatures of its enclaves, which must be at least the threshold. Enclaves outside the
+// largest group are reported as mismatched, so a single faulty enclave cannot cause the
+// outputs of honest enclaves to be rejected.
+func (o *Prover) collect(outputs []*enclave.Proposal, errs []error) (*enclave.Proposal, []hexutil.Bytes, error) {
+	type outputKey struct {
+		outputRoot    common.Hash
+		l1OriginHash  common.Hash
+		l2BlockNumber string
+	}
+	groups := make(map[outputKey][]int)
+	var largest []int
+	for i, out := range outputs {
+		if errs[i] != nil {
+			continue
+		}
+		key := outputKey{out.OutputRoot, out.L1OriginHash, out.L2BlockNumber.String()}
+		groups[key] = append(groups[key], i)
+		// ties are broken by the lowest enclave index
+		if group := groups[key]; len(group) > len(largest) {
+			largest = group
+		}
+	}
+
+	var output *enclave.Proposal
+	if len(largest) > 0 {
+		output = outputs[largest[0]]
+	}
+	var failed []error
+	signatures := make([]hexutil.Bytes, len(o.enclaves))
+	for i, out := range outputs {
+		if errs[i] == nil && !slices.Contains(largest, i) {
+			errs[i] = fmt.Errorf("output does not match the output of most enclaves: %s != %s", out.OutputRoot, output.OutputRoot)
+		}
+		if errs[i] != nil {
+			if len(o.enclaves) > 1 {
+				log.Warn("Enclave failed to sign proposal", "enclave", i, "err", errs[i])
+			}
+			failed = append(failed, errs[i])
+			continue
+		}
+		signatures[i] = out.Signature
+	}
+	if len(largest) < o.threshold {
+		return nil, nil, errors.Join(failed...)
+	}
+	return output, signatures, nil
+}
+
+// capture writes the inputs to the capture directory if execution failed, or if any
+// of the blocks are in the list of blocks to capture.
+func (o *Prover) capture(inputs []*proverInput, executeErr error) {
+	if o.captureDir == "" {
+		return
+	}
+	capture := executeErr != nil
+	for _, input := range inputs {
+		_, ok := o.captureBlocks[input.BlockHeader.Number.Uint64()]
+		capture = capture || ok
+	}
+	if !capture {
+		return
+	}
+	c := &enclave.Capture{
+		Config:             o.config,
+		PrevMessageAccount: inputs[0].prevMessageAccount,
+		Blocks:             make([]*enclave.BlockInput, len(inputs)),
+	}
+	for i, input := range inputs {
+		c.Blocks[i] = &input.BlockInput
+	}
+	path := filepath.Join(o.captureDir, fmt.Sprintf("blocks-%s-%s.json", inputs[0].BlockHeader.Number, inputs[len(inputs)-1].BlockHeader.Number))
+	if err := c.Write(path); err != nil {
+		log.Warn("Failed to write enclave inputs capture", "path", path, "err", err)
+		return
+	}
+	log.Info("Captured enclave inputs", "path", path, "failed", executeErr != nil)
+}
+
+func (o *Prover) fetchInput(ctx context.Context, block *types.Block) (*proverInput, error) {
 	witnessCh := await(func() (*stateless.ExecutionWitness, error) {
 		return o.l2.ExecutionWitness(ctx, block.Hash())
 	}, func(err error) error {
@@ -118,6 +378,15 @@ func (o *Prover) Generate(ctx context.Context, block *types.Block) (*Proposal, e
 		return nil, &multierror.Error{Errors: errors}
 	}
 
+	parentRef, err := derive.L2BlockToBlockRef(o.config.ToRollupConfig(), previousBlock.value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive block ref from previous L2 block: %w", err)
+	}
+	l1OriginChain, err := o.fetchL1OriginChain(ctx, parentRef.L1Origin, l1Origin.value)
+	if err != nil {
+		return nil, err
+	}
+
 	marshalTxs := func(txs types.Transactions, includeDeposits bool) ([]hexutil.Bytes, error) {
 		var rlps []hexutil.Bytes
 		for _, tx := range txs {
@@ -141,39 +410,59 @@ func (o *Prover) Generate(ctx context.Context, block *types.Block) (*Proposal, e
 		return nil, err
 	}
 
-	output, err := o.enclave.ExecuteStateless(
-		ctx,
-		o.config,
-		l1Origin.value,
-		l1Receipts.value,
-		previousTxs,
-		block.Header(),
-		sequencedTxs,
-		witness.value,
-		messageAccount.value,
-		prevMessageAccount.value.StorageHash,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute enclave state transition: %w", err)
+	return &proverInput{
+		BlockInput: enclave.BlockInput{
+			L1Origin:         l1Origin.value,
+			L1Receipts:       l1Receipts.value,
+			L1OriginChain:    l1OriginChain,
+			PreviousBlockTxs: previousTxs,
+			BlockHeader:      block.Header(),
+			SequencedTxs:     sequencedTxs,
+			Witness:          witness.value,
+			MessageAccount:   messageAccount.value,
+		},
+		blockRef:           blockRef,
+		prevMessageAccount: prevMessageAccount.value,
+		withdrawals:        block.Bloom().Test(predeploys.L2ToL1MessagePasserAddr.Bytes()),
+	}, nil
+}
+
+// fetchL1OriginChain fetches the L1 blocks between the parent's L1 origin and the L1
+// origin of a block, if the L1 origin advanced by more than one block.
+func (o *Prover) fetchL1OriginChain(ctx context.Context, parentOrigin eth.BlockID, l1Origin *types.Header) ([]*enclave.L1Block, error) {
+	number := l1Origin.Number.Uint64()
+	if number <= parentOrigin.Number+1 {
+		return nil, nil
 	}
-	if output.L1OriginHash != blockRef.L1Origin.Hash {
-		return nil, fmt.Errorf("output L1 origin hash does not match expected: %s != %s", output.L1OriginHash, blockRef.L1Origin.Hash)
+	length := number - parentOrigin.Number - 1
+	if length > enclave.MaxL1OriginChainLength {
+		return nil, fmt.Errorf("L1 origin advanced by %d blocks, limit is %d", length, enclave.MaxL1OriginChainLength)
 	}
-	if output.L2BlockNumber.ToInt().Cmp(block.Number()) != 0 {
-		return nil, fmt.Errorf("output L2 block number does not match expected: %s != %s", output.L2BlockNumber, block.Number())
+	chain := make([]*enclave.L1Block, length)
+	hash := l1Origin.ParentHash
+	for i := len(chain) - 1; i >= 0; i-- {
+		header, err := o.l1.HeaderByHash(ctx, hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch L1 header %s: %w", hash, err)
+		}
+		receipts, err := o.l1.BlockReceipts(ctx, hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch L1 receipts %s: %w", hash, err)
+		}
+		chain[i] = &enclave.L1Block{
+			Header:   header,
+			Receipts: receipts,
+		}
+		hash = header.ParentHash
 	}
-	outputRoot := enclave.OutputRootV0(block.Header(), block.Root())
-	if output.OutputRoot != outputRoot {
-		return nil, fmt.Errorf("output root does not match expected: %s != %s", output.OutputRoot, outputRoot)
+	if hash != parentOrigin.Hash {
+		return nil, fmt.Errorf("L1 origin chain does not link to the parent's L1 origin %s", parentOrigin)
 	}
-	return &Proposal{
-		Output:      output,
-		From:        blockRef,
-		To:          blockRef,
-		Withdrawals: block.Bloom().Test(predeploys.L2ToL1MessagePasserAddr.Bytes()),
-	}, nil
+	return chain, nil
 }
 
+// Aggregate aggregates the proposals on each enclave that signed all of them, and
+// returns the aggregated proposal if at least the threshold of enclaves succeeded.
 func (o *Prover) Aggregate(ctx context.Context, prevOutputRoot common.Hash, proposals []*Proposal) (*Proposal, error) {
 	if len(proposals) == 0 {
 		return nil, fmt.Errorf("no proposals to aggregate")
@@ -181,24 +470,120 @@ func (o *Prover) Aggregate(ctx context.Context, prevOutputRoot common.Hash, prop
 	if len(proposals) == 1 {
 		return proposals[0], nil
 	}
-	prop := make([]*enclave.Proposal, len(proposals))
 	withdrawals := false
-	for i, p := range proposals {
-		prop[i] = p.Output
+	for _, p := range proposals {
 		withdrawals = withdrawals || p.Withdrawals
 	}
-	output, err := o.enclave.Aggregate(ctx, o.configHash, prevOutputRoot, prop)
+	outputs := make([]*enclave.Proposal, len(o.enclaves))
+	errs := make([]error, len(o.enclaves))
+	var wg sync.WaitGroup
+	for i, enclav := range o.enclaves {
+		prop := make([]*enclave.Proposal, len(proposals))
+		for j, p := range proposals {
+			if p.Signatures[i] == nil {
+				errs[i] = fmt.Errorf("enclave did not sign proposal %d", j)
+				break
+			}
+			prop[j] = &enclave.Proposal{
+				OutputRoot:    p.Output.OutputRoot,
+				Signature:     p.Signatures[i],
+				L1OriginHash:  p.Output.L1OriginHash,
+				L2BlockNumber: p.Output.L2BlockNumber,
+			}
+		}
+		if errs[i] != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outputs[i], errs[i] = enclav.Aggregate(ctx, o.configHash, prevOutputRoot, prop, o.aggregateConfig())
+		}()
+	}
+	wg.Wait()
+	output, signatures, err := o.collect(outputs, errs)
 	if err != nil {
 		return nil, fmt.Errorf("failed to aggregate proposals: %w", err)
 	}
+	parts := make([]*envelopePart, len(proposals))
+	for i, p := range proposals {
+		parts[i] = &envelopePart{
+			From:       p.From.Number,
+			To:         p.To.Number,
+			OutputRoot: p.Output.OutputRoot,
+		}
+	}
+	o.writeEnvelopes(aggregatedEnvelopesName(proposals[0].From, proposals[len(proposals)-1].To), &envelopeRecord{
+		From:           proposals[0].From,
+		To:             proposals[len(proposals)-1].To,
+		PrevOutputRoot: &prevOutputRoot,
+		Parts:          parts,
+	}, outputs, errs)
 	return &Proposal{
 		Output:      output,
+		Signatures:  signatures,
 		From:        proposals[0].From,
 		To:          proposals[len(proposals)-1].To,
 		Withdrawals: withdrawals,
 	}, nil
 }
 
+// aggregateConfig returns the config to pass to enclave_aggregate, which is only needed
+// to sign proposals with a signing domain, and omitted otherwise so that older enclaves
+// accept the call.
+func (o *Prover) aggregateConfig() *enclave.PerChainConfig {
+	if o.config.SigningDomain == nil {
+		return nil
+	}
+	return o.config
+}
+
+func (o *Prover) signingProposal(prevOutputRoot common.Hash, proposal *Proposal) *signing.Proposal {
+	return &signing.Proposal{
+		ConfigHash:     o.configHash,
+		L1OriginHash:   proposal.Output.L1OriginHash,
+		L2BlockNumber:  proposal.Output.L2BlockNumber.ToInt(),
+		PrevOutputRoot: prevOutputRoot,
+		OutputRoot:     proposal.Output.OutputRoot,
+	}
+}
+
+// Signers recovers the address of the enclave signer of each of the proposal's
+// signatures, or the zero address if the enclave did not sign it.
+func (o *Prover) Signers(prevOutputRoot common.Hash, proposal *Proposal) ([]common.Address, error) {
+	p := o.signingProposal(prevOutputRoot, proposal)
+	version, domain := o.config.Signing()
+	signers := make([]common.Address, len(proposal.Signatures))
+	for i, signature := range proposal.Signatures {
+		if signature == nil {
+			continue
+		}
+		signer, err := signing.Recover(version, domain, p, signature)
+		if err != nil {
+			return nil, fmt.Errorf("enclave %d: %w", i, err)
+		}
+		signers[i] = signer
+	}
+	return signers, nil
+}
+
+// EncodeSignatures encodes the given signatures of the proposal as a signature list for
+// the OutputOracle.
+func (o *Prover) EncodeSignatures(prevOutputRoot common.Hash, proposal *Proposal, signatures [][]byte) ([]byte, error) {
+	version, domain := o.config.Signing()
+	return signing.EncodeSignatures(version, domain, o.signingProposal(prevOutputRoot, proposal), signatures)
+}
+
+// ConfigHash returns the hash of the enclave chain config that proposals are signed for.
+func (o *Prover) ConfigHash() common.Hash {
+	return o.configHash
+}
+
+// Threshold returns the number of enclave signatures submitted with each proposal.
+func (o *Prover) Threshold() int {
+	return o.threshold
+}
+
 type result[E any] struct {
 	value E
 	err   error
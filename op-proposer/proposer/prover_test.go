@@ -0,0 +1,47 @@
+package proposer
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/base/op-enclave/op-enclave/enclave"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func TestCollect(t *testing.T) {
+	proposal := func(outputRoot byte, signature byte) *enclave.Proposal {
+		return &enclave.Proposal{
+			OutputRoot:    common.Hash{outputRoot},
+			Signature:     hexutil.Bytes{signature},
+			L1OriginHash:  common.Hash{1},
+			L2BlockNumber: (*hexutil.Big)(big.NewInt(10)),
+		}
+	}
+	// the first enclave to respond is faulty
+	outputs := []*enclave.Proposal{proposal(0xff, 0), proposal(2, 1), nil, proposal(2, 3)}
+	newErrs := func() []error {
+		return []error{nil, nil, errors.New("enclave unavailable"), nil}
+	}
+
+	o := &Prover{enclaves: make([]enclave.RPC, len(outputs)), threshold: 2}
+	output, signatures, err := o.collect(outputs, newErrs())
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if output.OutputRoot != (common.Hash{2}) {
+		t.Fatalf("collected output root %s is not the majority output root", output.OutputRoot)
+	}
+	expected := []hexutil.Bytes{nil, {1}, nil, {3}}
+	for i := range expected {
+		if string(signatures[i]) != string(expected[i]) {
+			t.Fatalf("signature of enclave %d is %s, expected %s", i, signatures[i], expected[i])
+		}
+	}
+
+	o.threshold = 3
+	if _, _, err = o.collect(outputs, newErrs()); err == nil {
+		t.Fatal("outputs below the threshold were collected")
+	}
+}
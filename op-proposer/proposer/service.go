@@ -2,9 +2,11 @@ package proposer
 
 import (
 	"context"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"sync/atomic"
 	"time"
 
@@ -20,6 +22,7 @@ import (
 	oprpc "github.com/ethereum-optimism/optimism/op-service/rpc"
 	"github.com/ethereum-optimism/optimism/op-service/txmgr"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/log"
 	gethrpc "github.com/ethereum/go-ethereum/rpc"
@@ -46,6 +49,32 @@ type ProposerConfig struct {
 	WaitNodeSync bool
 
 	MinProposalInterval uint64
+
+	// EnclaveThreshold is the number of enclave signatures required for, and submitted
+	// with, each proposal. Values above 1 require an OutputOracle that verifies signature
+	// lists; other enclaves only provide redundancy.
+	EnclaveThreshold uint64
+
+	// ConfigVersion is the version of the enclave chain config (see enclave.FromRollupConfig),
+	// whose hash must match the OutputOracle's config hash. It also selects the proposal
+	// signing scheme: version 2 configs are signed with EIP-712 typed data.
+	ConfigVersion uint64
+
+	// ExecutionRangeSize is the maximum number of L2 blocks executed in a single enclave call.
+	ExecutionRangeSize uint64
+
+	// EnclaveWireFormat forces the wire format for enclave execution payloads. If empty,
+	// the format is negotiated with the enclave.
+	EnclaveWireFormat enclave.WireFormat
+
+	// CaptureDir is the directory that enclave execution inputs are written to when the
+	// enclave rejects a block, or for blocks in CaptureBlocks. Capturing is disabled if empty.
+	CaptureDir    string
+	CaptureBlocks []uint64
+
+	// EnvelopeDir is the directory that the signed response envelopes of each generated
+	// and aggregated proposal are written to. Disabled if empty.
+	EnvelopeDir string
 }
 
 type ProposerService struct {
@@ -54,12 +83,12 @@ type ProposerService struct {
 
 	ProposerConfig
 
-	TxManager     txmgr.TxManager
-	L1Client      *ethclient.Client
-	L2Client      *ethclient.Client
-	L2Reth        bool
-	RollupClient  *gethrpc.Client
-	EnclaveClient *gethrpc.Client
+	TxManager      txmgr.TxManager
+	L1Client       *ethclient.Client
+	L2Client       *ethclient.Client
+	L2Reth         bool
+	RollupClient   *gethrpc.Client
+	EnclaveClients []*gethrpc.Client
 
 	driver *L2OutputSubmitter
 
@@ -96,6 +125,13 @@ func (ps *ProposerService) initFromCLIConfig(ctx context.Context, version string
 	ps.AllowNonFinalized = cfg.AllowNonFinalized
 	ps.WaitNodeSync = cfg.WaitNodeSync
 	ps.MinProposalInterval = cfg.MinProposalInterval
+	ps.EnclaveThreshold = cfg.EnclaveThreshold
+	ps.ConfigVersion = cfg.ConfigVersion
+	ps.ExecutionRangeSize = cfg.ExecutionRangeSize
+	ps.EnclaveWireFormat = enclave.WireFormat(cfg.EnclaveWireFormat)
+	ps.CaptureDir = cfg.CaptureDir
+	ps.CaptureBlocks = cfg.CaptureBlocks
+	ps.EnvelopeDir = cfg.EnvelopeDir
 
 	ps.initL2ooAddress(cfg)
 
@@ -144,15 +180,52 @@ func (ps *ProposerService) initRPCClients(ctx context.Context, cfg *CLIConfig) e
 	}
 	ps.RollupClient = rollupClient
 
-	enclaveClient, err := dial.DialRPCClientWithTimeout(ctx, dial.DefaultDialTimeout, ps.Log, cfg.EnclaveRpc)
-	if err != nil {
-		return fmt.Errorf("failed to dial enclave RPC: %w", err)
+	for _, url := range cfg.EnclaveRpcs {
+		var enclaveClient *gethrpc.Client
+		if len(cfg.EnclavePCR0) > 0 {
+			enclaveClient, err = dialEnclaveRATLS(ctx, cfg, url)
+		} else {
+			enclaveClient, err = dial.DialRPCClientWithTimeout(ctx, dial.DefaultDialTimeout, ps.Log, url)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to dial enclave RPC %s: %w", url, err)
+		}
+		ps.EnclaveClients = append(ps.EnclaveClients, enclaveClient)
 	}
-	ps.EnclaveClient = enclaveClient
 
 	return nil
 }
 
+// dialEnclaveRATLS dials the enclave's RA-TLS endpoint, which verifies the enclave's
+// attestation during the TLS handshake.
+func dialEnclaveRATLS(ctx context.Context, cfg *CLIConfig, url string) (*gethrpc.Client, error) {
+	var ratls enclave.RATLSConfig
+	for _, pcr := range cfg.EnclavePCR0 {
+		value, err := hexutil.Decode(pcr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid enclave PCR0 %s: %w", pcr, err)
+		}
+		ratls.PCR0 = append(ratls.PCR0, value)
+	}
+	if cfg.EnclaveCARoots != "" {
+		roots, err := os.ReadFile(cfg.EnclaveCARoots)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read enclave CA roots: %w", err)
+		}
+		ratls.Roots = x509.NewCertPool()
+		if !ratls.Roots.AppendCertsFromPEM(roots) {
+			return nil, errors.New("failed to parse enclave CA roots")
+		}
+	}
+	option, err := enclave.RATLSClientOption(ratls)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, dial.DefaultDialTimeout)
+	defer cancel()
+	return gethrpc.DialOptions(ctx, url, option)
+}
+
 func (ps *ProposerService) initMetrics(cfg *CLIConfig) {
 	procName := "default"
 	ps.Metrics = metrics.NewMetrics(procName)
@@ -222,15 +295,19 @@ func (ps *ProposerService) initDriver() error {
 	} else {
 		l2Client = NewClient(ps.L2Client, ps.Metrics.L2Cache)
 	}
+	enclaveClients := make([]enclave.RPC, len(ps.EnclaveClients))
+	for i, client := range ps.EnclaveClients {
+		enclaveClients[i] = &enclave.Client{Client: client, WireFormat: ps.EnclaveWireFormat}
+	}
 	driver, err := NewL2OutputSubmitter(DriverSetup{
-		Log:           ps.Log,
-		Metr:          ps.Metrics,
-		Cfg:           ps.ProposerConfig,
-		Txmgr:         ps.TxManager,
-		L1Client:      NewClient(ps.L1Client, ps.Metrics.L1Cache),
-		L2Client:      l2Client,
-		RollupClient:  NewRollupClient(ps.RollupClient, ps.Metrics.WitnessCache),
-		EnclaveClient: &enclave.Client{Client: ps.EnclaveClient},
+		Log:            ps.Log,
+		Metr:           ps.Metrics,
+		Cfg:            ps.ProposerConfig,
+		Txmgr:          ps.TxManager,
+		L1Client:       NewClient(ps.L1Client, ps.Metrics.L1Cache),
+		L2Client:       l2Client,
+		RollupClient:   NewRollupClient(ps.RollupClient, ps.Metrics.WitnessCache),
+		EnclaveClients: enclaveClients,
 	})
 	if err != nil {
 		return err
@@ -331,8 +408,8 @@ func (ps *ProposerService) Stop(ctx context.Context) error {
 		ps.RollupClient.Close()
 	}
 
-	if ps.EnclaveClient != nil {
-		ps.EnclaveClient.Close()
+	for _, enclaveClient := range ps.EnclaveClients {
+		enclaveClient.Close()
 	}
 
 	if result == nil {